@@ -0,0 +1,158 @@
+package myrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLivenessTimeout is the default maximum time poll loop may not make progress while server is alive.
+// It should be longer than wait time of receiving message.
+const DefaultLivenessTimeout = time.Minute
+
+// DefaultHandlerTimeout is the default maximum time a message may be handled while server is alive
+const DefaultHandlerTimeout = 15 * time.Minute
+
+// HealthChecker is implemented by message receivers that could check their connection to message service
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// AdminConf contains info about admin HTTP server
+type AdminConf struct {
+	Addr            string        `yaml:"addr"`
+	LivenessTimeout time.Duration `yaml:"liveness_timeout"`
+	// HandlerTimeout is the maximum time a message may be handled, so a longer handler is considered stuck.
+	// It should be longer than the slowest handler.
+	HandlerTimeout time.Duration `yaml:"handler_timeout"`
+}
+
+// NewAdminHandler returns HTTP handler of admin endpoints of given server:
+//
+//	GET  /healthz  liveness: poll loop has made progress within liveness timeout,
+//	               or it waits for handlers that all started within handler timeout
+//	GET  /readyz   readiness: receiver is reachable and server is not shutting down
+//	GET  /services registered services and methods
+//	GET  /stats    in-flight messages and worker pool stats
+//	POST /pause    stop receiving messages
+//	POST /resume   restart receiving messages
+func NewAdminHandler(srv *RPCServer, conf AdminConf) http.Handler {
+	if conf.LivenessTimeout <= 0 {
+		conf.LivenessTimeout = DefaultLivenessTimeout
+	}
+	if conf.HandlerTimeout <= 0 {
+		conf.HandlerTimeout = DefaultHandlerTimeout
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		st := srv.Stats()
+		now := srv.stats.now()
+		status := map[string]interface{}{"status": "ok", "last_poll": st.LastPoll, "oldest_in_flight": st.OldestInFlight}
+		// poll loop waits for running handlers, so it is alive while none of them is stuck
+		alive := now.Sub(st.LastPoll) <= conf.LivenessTimeout ||
+			(!st.OldestInFlight.IsZero() && now.Sub(st.OldestInFlight) <= conf.HandlerTimeout)
+		if !alive {
+			status["status"] = "stuck"
+			writeJSON(w, http.StatusServiceUnavailable, status)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := srv.checkReady(); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.Services())
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.Stats())
+	})
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		srv.Pause()
+		writeJSON(w, http.StatusOK, srv.Stats())
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		srv.Resume()
+		writeJSON(w, http.StatusOK, srv.Stats())
+	})
+
+	return mux
+}
+
+// StartAdmin starts admin HTTP server in background.
+// It is stopped when Serve returns.
+func (srv *RPCServer) StartAdmin(conf AdminConf) error {
+	ln, err := net.Listen("tcp", conf.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "cannot start admin server on %s", conf.Addr)
+	}
+
+	httpSrv := &http.Server{Addr: conf.Addr, Handler: NewAdminHandler(srv, conf)}
+	go func() {
+		if err := httpSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			srv.logger.Error("admin server stopped", Field{Key: "addr", Value: conf.Addr}, errField(err))
+		}
+	}()
+
+	srv.locker.Lock()
+	srv.adminServer = httpSrv
+	srv.locker.Unlock()
+	srv.logger.Info("started admin server", Field{Key: "addr", Value: conf.Addr})
+
+	return nil
+}
+
+// checkReady returns error if server is not ready to receive messages
+func (srv *RPCServer) checkReady() error {
+	if srv.Stats().ShuttingDown {
+		return errors.New("shutting down")
+	}
+	for _, q := range srv.queues {
+		if hc, ok := q.receiver.(HealthChecker); ok {
+			if err := hc.CheckHealth(); err != nil {
+				return errors.Wrapf(err, "receiver of queue %s is unreachable", q.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// stopAdmin stops admin HTTP server if it is started
+func (srv *RPCServer) stopAdmin() {
+	srv.locker.Lock()
+	httpSrv := srv.adminServer
+	srv.locker.Unlock()
+	if httpSrv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpSrv.Shutdown(ctx); err != nil {
+		srv.logger.Warn("cannot stop admin server", errField(err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,87 @@
+package myrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartAdminAddressInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srv := NewRPCServer(context.Background(), nil, nil)
+	if err := srv.StartAdmin(AdminConf{Addr: ln.Addr().String()}); err == nil {
+		srv.stopAdmin()
+		t.Fatal("admin server is started on address in use")
+	}
+}
+
+// fakeClock is a clock that moves only when it is advanced
+type fakeClock struct {
+	locker sync.Mutex
+	t      time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.locker.Lock()
+	c.t = c.t.Add(d)
+	c.locker.Unlock()
+}
+
+func TestLivenessWhileHandlerRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewMemoryQueue()
+	srv := NewRPCServer(ctx, q, q)
+	clock := &fakeClock{t: time.Now()}
+	srv.stats.clock = clock.now
+	running, release := make(chan struct{}), make(chan struct{})
+	srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+		"slow": {Name: "slow", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			close(running)
+			<-release
+			return nil, nil
+		}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+			return nil, nil
+		}},
+	}})
+	go srv.Serve()
+	if err := NewRPCClient(ctx, q).SendAsyncMsg("svc", "slow", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-running
+
+	admin := NewAdminHandler(srv, AdminConf{LivenessTimeout: time.Minute, HandlerTimeout: 10 * time.Minute})
+	healthz := func() int {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	clock.advance(5 * time.Minute)
+	if code := healthz(); code != http.StatusOK {
+		t.Fatalf("server running handler within handler timeout is not alive: %d", code)
+	}
+	clock.advance(6 * time.Minute)
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Fatalf("server running handler over handler timeout is alive: %d", code)
+	}
+
+	close(release)
+	waitFor(t, "poll loop made progress", func() bool { return healthz() == http.StatusOK })
+}
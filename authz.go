@@ -0,0 +1,165 @@
+package myrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Metadata keys of identity of message sender
+const (
+	MetadataPrincipal = "myrpc-principal"
+	MetadataRoles     = "myrpc-roles"
+)
+
+// policyWildcard matches any principal, role, service or method in policy
+const policyWildcard = "*"
+
+// Identity is the identity of message sender.
+// Server trusts identity of signing key of verified message only, see RPCServer.UseKeyIdentities.
+type Identity struct {
+	Principal string
+	Roles     []string
+}
+
+// IdentityFromMsg returns identity of sender that is carried in message metadata, as claimed by sender
+func IdentityFromMsg(msg *RPCMessage) Identity {
+	id := Identity{Principal: msg.Metadata[MetadataPrincipal]}
+	if roles := msg.Metadata[MetadataRoles]; roles != "" {
+		id.Roles = strings.Split(roles, ",")
+	}
+
+	return id
+}
+
+// identityOf returns identity of sender of message. If server verifies messages, it is the identity
+// of signing key of message, or key id as principal if key has no identity, and identity claimed in metadata
+// must be a part of it. Otherwise it is the identity in metadata, that is not used for authorization.
+func (srv *RPCServer) identityOf(msg *RPCMessage) (Identity, error) {
+	claimed := IdentityFromMsg(msg)
+	if srv.verifier == nil || msg.Signature == nil {
+		return claimed, nil
+	}
+
+	keyID := msg.Signature.KeyID
+	id, ok := srv.keyIdentities[keyID]
+	if !ok {
+		id = Identity{Principal: keyID}
+	}
+	if claimed.Principal != "" && claimed.Principal != id.Principal {
+		return id, errors.Errorf("principal %s is not of signing key %s", claimed.Principal, keyID)
+	}
+	for _, role := range claimed.Roles {
+		if !hasString(id.Roles, role) {
+			return id, errors.Errorf("role %s is not of signing key %s", role, keyID)
+		}
+	}
+
+	return id, nil
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorizer is the interface to check whether a sender may invoke a method
+type Authorizer interface {
+	// Authorize returns error if given identity is not allowed to invoke given method
+	Authorize(id Identity, svr ServiceName, mth MethodName) error
+}
+
+// AuthzAuditFnc is called on each denied message, with the reason of denial
+type AuthzAuditFnc func(id Identity, svr ServiceName, mth MethodName, reason error)
+
+// PolicyConf contains authorization policies.
+// A method is allowed if any policy matches both sender and method, otherwise it is denied.
+type PolicyConf struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// Policy allows senders having any of given principals or roles to invoke given methods
+type Policy struct {
+	Name       string         `yaml:"name"`
+	Principals []string       `yaml:"principals"`
+	Roles      []string       `yaml:"roles"`
+	Allow      []PolicyTarget `yaml:"allow"`
+}
+
+// PolicyTarget is a service and its methods. "*" matches all services or methods
+type PolicyTarget struct {
+	Service ServiceName  `yaml:"service"`
+	Methods []MethodName `yaml:"methods"`
+}
+
+// PolicyConfFromYamlFile returns PolicyConf from given yaml conf file
+func PolicyConfFromYamlFile(filePath string) (*PolicyConf, error) {
+	var pc PolicyConf
+	if err := yamlFileToStruct(filePath, "policy", &pc); err != nil {
+		return nil, err
+	}
+
+	return &pc, nil
+}
+
+type policyAuthorizer struct {
+	conf PolicyConf
+}
+
+// NewPolicyAuthorizer returns an authorizer that evaluates given policies
+func NewPolicyAuthorizer(conf PolicyConf) Authorizer {
+	return &policyAuthorizer{conf: conf}
+}
+
+func (pa *policyAuthorizer) Authorize(id Identity, svr ServiceName, mth MethodName) error {
+	if id.Principal == "" && len(id.Roles) == 0 {
+		return errors.New("no identity")
+	}
+
+	for _, p := range pa.conf.Policies {
+		if p.matchIdentity(id) && p.matchMethod(svr, mth) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s is not allowed to invoke %s/%s", id.Principal, svr, mth)
+}
+
+func (p *Policy) matchIdentity(id Identity) bool {
+	for _, principal := range p.Principals {
+		if principal == policyWildcard || principal == id.Principal {
+			return true
+		}
+	}
+
+	for _, role := range p.Roles {
+		for _, idRole := range id.Roles {
+			if role == policyWildcard || role == idRole {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) matchMethod(svr ServiceName, mth MethodName) bool {
+	for _, target := range p.Allow {
+		if target.Service != policyWildcard && target.Service != svr {
+			continue
+		}
+		for _, m := range target.Methods {
+			if m == policyWildcard || m == mth {
+				return true
+			}
+		}
+	}
+
+	return false
+}
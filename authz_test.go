@@ -0,0 +1,127 @@
+package myrpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIdentityBoundToSigningKey(t *testing.T) {
+	signers := map[string]Signer{
+		"k1": NewHMACSigner("k1", []byte("secret1")),
+		"k2": NewHMACSigner("k2", []byte("secret2")),
+	}
+	verifier := NewHMACVerifier(map[string][]byte{"k1": []byte("secret1"), "k2": []byte("secret2")})
+	policy := PolicyConf{Policies: []Policy{
+		{Name: "admin", Principals: []string{"admin"}, Allow: []PolicyTarget{{Service: "svc", Methods: []MethodName{"*"}}}},
+		{Name: "k2", Principals: []string{"k2"}, Allow: []PolicyTarget{{Service: "svc", Methods: []MethodName{"read"}}}},
+	}}
+
+	tests := []struct {
+		name     string
+		key      string
+		metadata map[string]string
+		mth      MethodName
+		allowed  bool
+	}{
+		{name: "identity of key", key: "k1", mth: "write", allowed: true},
+		{name: "claimed identity of key", key: "k1", metadata: map[string]string{MetadataPrincipal: "admin", MetadataRoles: "ops"}, mth: "write", allowed: true},
+		{name: "key id as principal", key: "k2", mth: "read", allowed: true},
+		{name: "principal of another key", key: "k2", metadata: map[string]string{MetadataPrincipal: "admin"}, mth: "write"},
+		{name: "role not of key", key: "k1", metadata: map[string]string{MetadataRoles: "root"}, mth: "write"},
+		{name: "not allowed", key: "k2", mth: "write"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetter := &recordingSender{}
+			srv := NewRPCServer(context.Background(), NewMemoryQueue(), nil)
+			srv.UseVerifier(verifier, 0)
+			srv.UseKeyIdentities(map[string]Identity{"k1": {Principal: "admin", Roles: []string{"ops"}}})
+			srv.UseAuthorizer(NewPolicyAuthorizer(policy), nil)
+			srv.SetDeadLetterSender(deadLetter)
+			srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+				tt.mth: {Name: tt.mth, Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+					return nil, nil
+				}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+					return nil, nil
+				}},
+			}})
+
+			msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: tt.mth, Payload: []byte("{}"), Metadata: tt.metadata}
+			if err := signMsg(msg, signers[tt.key]); err != nil {
+				t.Fatal(err)
+			}
+			if err := srv.handleMsg(srv.queues[0], msg); err != nil {
+				t.Fatal(err)
+			}
+			if rejected := len(deadLetter.msgs) > 0; rejected == tt.allowed {
+				t.Fatalf("allowed %t, but rejected %t", tt.allowed, rejected)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTopicOfMsg(t *testing.T) {
+	policy := PolicyConf{Policies: []Policy{
+		{Name: "reader", Principals: []string{"k1"}, Allow: []PolicyTarget{{Service: "svc", Methods: []MethodName{"read"}}}},
+	}}
+	deadLetter := &recordingSender{}
+	srv := NewRPCServer(context.Background(), NewMemoryQueue(), nil)
+	srv.UseVerifier(NewHMACVerifier(map[string][]byte{"k1": []byte("secret1")}), 0)
+	srv.UseAuthorizer(NewPolicyAuthorizer(policy), nil)
+	srv.SetDeadLetterSender(deadLetter)
+	handled := false
+	srv.RegisterTopic("orders", nil, MethodDescription{Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+		handled = true
+		return nil, nil
+	}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+		return nil, nil
+	}})
+
+	// sender allowed to call svc/read sets topic to run handler of topic
+	msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "read", Topic: "orders", Payload: []byte("{}")}
+	if err := signMsg(msg, NewHMACSigner("k1", []byte("secret1"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.handleMsg(srv.queues[0], msg); err != nil {
+		t.Fatal(err)
+	}
+	if handled || len(deadLetter.msgs) != 1 {
+		t.Fatalf("message of topic not allowed is handled %t, rejected %d", handled, len(deadLetter.msgs))
+	}
+}
+
+func TestAuthorizerRequiresVerifier(t *testing.T) {
+	policy := PolicyConf{Policies: []Policy{
+		{Name: "admin", Principals: []string{"admin"}, Allow: []PolicyTarget{{Service: "*", Methods: []MethodName{"*"}}}},
+	}}
+	srv := NewRPCServer(context.Background(), NewMemoryQueue(), nil)
+	srv.UseAuthorizer(NewPolicyAuthorizer(policy), nil)
+	if err := srv.Serve(); err == nil || !strings.Contains(err.Error(), "requires verifier") {
+		t.Fatalf("Serve() error = %v, want error of missing verifier", err)
+	}
+
+	// with verifier, unsigned message claiming identity in metadata is rejected
+	deadLetter := &recordingSender{}
+	srv = NewRPCServer(context.Background(), NewMemoryQueue(), nil)
+	srv.UseVerifier(NewHMACVerifier(map[string][]byte{"k1": []byte("secret1")}), 0)
+	srv.UseAuthorizer(NewPolicyAuthorizer(policy), nil)
+	srv.SetDeadLetterSender(deadLetter)
+	handled := false
+	srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+		"write": {Name: "write", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			handled = true
+			return nil, nil
+		}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+			return nil, nil
+		}},
+	}})
+	msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "write", Payload: []byte("{}"),
+		Metadata: map[string]string{MetadataPrincipal: "admin"}}
+	if err := srv.handleMsg(srv.queues[0], msg); err != nil {
+		t.Fatal(err)
+	}
+	if handled || len(deadLetter.msgs) != 1 {
+		t.Fatalf("unsigned message claiming admin is handled %t, rejected %d", handled, len(deadLetter.msgs))
+	}
+}
@@ -0,0 +1,94 @@
+package myrpc
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// defaultRoleSessionName is the session name of assumed role if not given
+const defaultRoleSessionName = "myrpc"
+
+// AWSRoleConf contains info about AWS credential chain and role to assume.
+// Without static keys, credentials are resolved by the default chain of AWS SDK:
+// environment variables, shared config and credentials files (including role_arn and source_profile of profile),
+// web identity, then ECS container or EC2 instance metadata.
+type AWSRoleConf struct {
+	// Profile is the profile of shared config and credentials files, AWS_PROFILE or "default" if empty
+	Profile string `yaml:"aws_profile"`
+	// AssumeRoleARN is the role assumed by the base credentials, if set
+	AssumeRoleARN   string `yaml:"assume_role_arn"`
+	ExternalID      string `yaml:"assume_role_external_id"`
+	RoleSessionName string `yaml:"assume_role_session_name"`
+	// STSEndpoint overrides endpoint of STS, such as a local fake STS
+	STSEndpoint string `yaml:"sts_endpoint"`
+	// EC2MetadataEndpoint overrides endpoint of EC2 instance metadata, such as a local fake one.
+	// It is the base URL, such as http://169.254.169.254, without the API version path.
+	EC2MetadataEndpoint string `yaml:"ec2_metadata_endpoint"`
+}
+
+// newAWSSession returns AWS session of given region.
+// Static keys are used only if both of them are given explicitly,
+// otherwise credentials are resolved by the default credential chain with shared config enabled.
+// The role of given conf is assumed on top of resolved credentials, if any.
+func newAWSSession(region, accessKeyID, secretAccessKey, sessionToken string, role AWSRoleConf) (*session.Session, error) {
+	cfg := aws.Config{
+		Region:                        aws.String(region),
+		CredentialsChainVerboseErrors: aws.Bool(true),
+		EndpointResolver:              role.endpointResolver(),
+	}
+	if accessKeyID != "" && secretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKeyID, secretAccessKey, sessionToken)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           role.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot init aws session")
+	}
+	if role.AssumeRoleARN == "" {
+		return sess, nil
+	}
+
+	creds := stscreds.NewCredentialsWithClient(sts.New(sess), role.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = role.RoleSessionName
+		if p.RoleSessionName == "" {
+			p.RoleSessionName = defaultRoleSessionName
+		}
+		if role.ExternalID != "" {
+			p.ExternalID = aws.String(role.ExternalID)
+		}
+	})
+
+	return sess.Copy(&aws.Config{Credentials: creds}), nil
+}
+
+// endpointResolver resolves endpoints of STS and EC2 instance metadata by overrides of conf, if any,
+// so they are used by both credential chain and assumed role
+func (role AWSRoleConf) endpointResolver() endpoints.Resolver {
+	defaultResolver := endpoints.DefaultResolver()
+	if role.STSEndpoint == "" && role.EC2MetadataEndpoint == "" {
+		return defaultResolver
+	}
+
+	return endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		switch {
+		case service == sts.EndpointsID && role.STSEndpoint != "":
+			return endpoints.ResolvedEndpoint{URL: role.STSEndpoint, SigningRegion: region}, nil
+		case service == ec2metadata.ServiceName && role.EC2MetadataEndpoint != "":
+			return endpoints.ResolvedEndpoint{URL: strings.TrimSuffix(role.EC2MetadataEndpoint, "/") + "/latest"}, nil
+		}
+
+		return defaultResolver.EndpointFor(service, region, opts...)
+	})
+}
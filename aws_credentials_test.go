@@ -0,0 +1,170 @@
+package myrpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isolateAWSEnv clears AWS environment of test, and points shared config and credentials files to given ones.
+// It returns func to restore the environment.
+func isolateAWSEnv(t *testing.T, configFile, credentialsFile string) func() {
+	env := map[string]string{
+		"AWS_CONFIG_FILE":                        configFile,
+		"AWS_SHARED_CREDENTIALS_FILE":            credentialsFile,
+		"AWS_ACCESS_KEY_ID":                      "",
+		"AWS_SECRET_ACCESS_KEY":                  "",
+		"AWS_SESSION_TOKEN":                      "",
+		"AWS_PROFILE":                            "",
+		"AWS_DEFAULT_PROFILE":                    "",
+		"AWS_ROLE_ARN":                           "",
+		"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     "",
+		"AWS_EC2_METADATA_DISABLED":              "",
+	}
+	old := map[string]*string{}
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeSTS returns STS answering AssumeRole with given access key, and records assumed roles
+func fakeSTS(t *testing.T, accessKeyID string, assumed *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRole" {
+			t.Errorf("unexpected STS request: %v", r.Form)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		*assumed = append(*assumed, r.Form.Get("RoleArn"))
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>assumed-secret</SecretAccessKey>
+      <SessionToken>assumed-token</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>%s/%s</Arn>
+      <AssumedRoleId>ARO123:%s</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>req</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`, accessKeyID, r.Form.Get("RoleArn"), r.Form.Get("RoleSessionName"), r.Form.Get("RoleSessionName"))
+	}))
+}
+
+func TestAWSSessionEC2Metadata(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer isolateAWSEnv(t, filepath.Join(dir, "config"), filepath.Join(dir, "credentials"))()
+
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			fmt.Fprint(w, "imds-token")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "instance-role")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/instance-role":
+			fmt.Fprint(w, `{"Code":"Success","Type":"AWS-HMAC","AccessKeyId":"imds-key",`+
+				`"SecretAccessKey":"imds-secret","Token":"imds-token","Expiration":"2100-01-01T00:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer imds.Close()
+
+	sess, err := newAWSSession("us-east-1", "", "", "", AWSRoleConf{EC2MetadataEndpoint: imds.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := sess.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "imds-key" {
+		t.Errorf("access key is %q, want imds-key", creds.AccessKeyID)
+	}
+}
+
+func TestAWSSessionAssumeRole(t *testing.T) {
+	const (
+		profileRole = "arn:aws:iam::123456789012:role/profile"
+		confRole    = "arn:aws:iam::123456789012:role/conf"
+	)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	configFile, credentialsFile := filepath.Join(dir, "config"), filepath.Join(dir, "credentials")
+	writeFile(t, credentialsFile, "[base]\naws_access_key_id = base-key\naws_secret_access_key = base-secret\n")
+	writeFile(t, configFile, "[profile app]\nrole_arn = "+profileRole+"\nsource_profile = base\n")
+	defer isolateAWSEnv(t, configFile, credentialsFile)()
+
+	tests := []struct {
+		name   string
+		keyID  string
+		secret string
+		role   AWSRoleConf
+		want   []string
+	}{
+		{name: "static keys", keyID: "static-key", secret: "static-secret", role: AWSRoleConf{AssumeRoleARN: confRole},
+			want: []string{confRole}},
+		{name: "role of profile", role: AWSRoleConf{Profile: "app"},
+			want: []string{profileRole}},
+		{name: "conf role on top of role of profile", role: AWSRoleConf{Profile: "app", AssumeRoleARN: confRole},
+			want: []string{profileRole, confRole}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var assumed []string
+			stsSrv := fakeSTS(t, "assumed-key", &assumed)
+			defer stsSrv.Close()
+			tt.role.STSEndpoint = stsSrv.URL
+
+			sess, err := newAWSSession("us-east-1", tt.keyID, tt.secret, "", tt.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			creds, err := sess.Config.Credentials.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyID != "assumed-key" {
+				t.Errorf("access key is %q, want assumed-key", creds.AccessKeyID)
+			}
+			if fmt.Sprint(assumed) != fmt.Sprint(tt.want) {
+				t.Errorf("assumed roles %v, want %v", assumed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package myrpc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBlobThreshold is the default size in bytes of encoded message, including its signature,
+// over which its payload is offloaded to blob store. It equals to SQS message size limit.
+const DefaultBlobThreshold = 256 * 1024
+
+// BlobStore is the interface to store large payloads outside of message service (claim-check pattern)
+type BlobStore interface {
+	// PutBlob stores data under given key
+	PutBlob(key string, data []byte) error
+	// GetBlob returns data stored under given key
+	GetBlob(key string) ([]byte, error)
+	// DeleteBlob deletes data stored under given key
+	DeleteBlob(key string) error
+}
+
+type fileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore returns a blob store that keeps blobs as files in given directory
+func NewFileBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create blob dir: %s", dir)
+	}
+
+	return &fileBlobStore{dir: dir}, nil
+}
+
+func (fs *fileBlobStore) PutBlob(key string, data []byte) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	// write to temp file then rename, so readers never see partial blob
+	tmp, err := ioutil.TempFile(fs.dir, ".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "cannot create temp file in %s", fs.dir)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "cannot write blob %s", key)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "cannot close blob %s", key)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "cannot save blob %s", key)
+	}
+
+	return nil
+}
+
+func (fs *fileBlobStore) GetBlob(key string) ([]byte, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read blob %s", key)
+	}
+
+	return data, nil
+}
+
+func (fs *fileBlobStore) DeleteBlob(key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot delete blob %s", key)
+	}
+
+	return nil
+}
+
+// validateBlobKey returns error if given key could escape the dir or prefix of blob store,
+// as keys come from messages
+func validateBlobKey(key string) error {
+	if key == "" || key == "." || strings.Contains(key, "..") || strings.ContainsAny(key, `/\`) {
+		return errors.Errorf("invalid blob key: %q", key)
+	}
+
+	return nil
+}
+
+// path returns file path of given key, keys must not escape the blob dir
+func (fs *fileBlobStore) path(key string) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(fs.dir, key), nil
+}
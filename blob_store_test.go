@@ -0,0 +1,68 @@
+package myrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+var invalidBlobKeys = []string{"", ".", "..", "../other", "a/b", `a\b`, "a..b"}
+
+func TestFileBlobStoreInvalidKey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range invalidBlobKeys {
+		if err := store.PutBlob(key, []byte("data")); err == nil {
+			t.Errorf("blob of invalid key %q is put", key)
+		}
+		if err := store.DeleteBlob(key); err == nil {
+			t.Errorf("blob of invalid key %q is deleted", key)
+		}
+	}
+}
+
+func TestS3BlobStoreKeyUnderPrefix(t *testing.T) {
+	var (
+		locker sync.Mutex
+		paths  []string
+	)
+	s3Srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locker.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		locker.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s3Srv.Close()
+
+	store, err := NewS3BlobStore(context.Background(), S3BlobStoreConf{Region: "us-east-1", Endpoint: s3Srv.URL,
+		Bucket: "bucket", KeyPrefix: "payloads", ForcePathStyle: true, AWSAccessKeyID: "key", AWSSecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range invalidBlobKeys {
+		if err := store.DeleteBlob(key); err == nil {
+			t.Errorf("blob of invalid key %q is deleted", key)
+		}
+		if _, err := store.GetBlob(key); err == nil {
+			t.Errorf("blob of invalid key %q is got", key)
+		}
+	}
+	if err := store.DeleteBlob("abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+	if len(paths) != 1 || paths[0] != "DELETE /bucket/payloads/abc" {
+		t.Errorf("requests to s3 are %v, want only delete of key under prefix", paths)
+	}
+}
@@ -0,0 +1,132 @@
+package myrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Call is a synchronous call in progress, see RPCClient.Go.
+// Its reply is passed by the reply listener of client, so an outstanding call holds no goroutine.
+type Call struct {
+	SvrName ServiceName
+	MthName MethodName
+	client  *RPCClient
+	id      string
+	locker  sync.Mutex
+	timer   *time.Timer
+	done    chan struct{}
+	once    sync.Once
+	reply   *RPCMessage
+	err     error
+}
+
+// Go sends request and returns its call without waiting for reply, like Go of net/rpc.
+// Reply is received from reply queue of client (see UseReplyQueue), until reply timeout of client.
+// If the request cannot be sent, the call is done with the error.
+// If no encodeFnc given, use client default encode instead.
+func (c *RPCClient) Go(svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) *Call {
+	return c.startCall(c.ctx, svr, mth, in, encodeFnc, opts)
+}
+
+// GoContext is Go within given ctx, and the call is canceled when ctx is done.
+// Deadline of ctx is sent as deadline of message, see RPCMessage.Deadline.
+// If ctx could be canceled, a goroutine watches it until the call is done.
+func (c *RPCClient) GoContext(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) *Call {
+	call := c.startCall(ctx, svr, mth, in, encodeFnc, opts)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				call.cancel(ctx.Err())
+			case <-call.done:
+			}
+		}()
+	}
+
+	return call
+}
+
+// startCall sends request within given ctx, and returns its call
+func (c *RPCClient) startCall(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts []CallOption) *Call {
+	call := &Call{
+		SvrName: svr,
+		MthName: mth,
+		client:  c,
+		done:    make(chan struct{}),
+	}
+	if c.replies == nil {
+		call.finish(nil, errors.New("no reply queue of client, see UseReplyQueue"))
+		return call
+	}
+
+	id, err := c.sendRequest(ctx, svr, mth, in, encodeFnc, opts, func(reply *RPCMessage) {
+		call.finish(reply, nil)
+	})
+	if err != nil {
+		call.finish(nil, err)
+		return call
+	}
+	call.id = id
+	timeout := c.replyTimeout
+	call.locker.Lock()
+	call.timer = time.AfterFunc(timeout, func() {
+		c.replies.unregister(id)
+		call.finish(nil, errors.Wrapf(ErrNoReply, "%s/%s is not replied in %s", svr, mth, timeout))
+	})
+	call.locker.Unlock()
+	select {
+	case <-call.done:
+		// replied before timer is set
+		call.timer.Stop()
+	default:
+	}
+
+	return call
+}
+
+// Done returns channel that is closed when the call is replied, timed out or canceled
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Result waits until the call is done, then returns its error,
+// or decodes its reply to out if out is not nil
+func (call *Call) Result(out interface{}) error {
+	<-call.done
+	if call.err != nil {
+		return call.err
+	}
+
+	return call.client.decodeReply(call.reply, out)
+}
+
+// Cancel stops waiting for reply, so its late reply is discarded.
+// Result of canceled call returns error with ErrNoReply as cause.
+func (call *Call) Cancel() {
+	call.cancel(errors.New("call is canceled"))
+}
+
+func (call *Call) cancel(reason error) {
+	if call.id != "" {
+		call.client.replies.unregister(call.id)
+	}
+	call.finish(nil, errors.Wrap(ErrNoReply, reason.Error()))
+}
+
+// finish sets reply or error of the call once, then closes its done channel
+func (call *Call) finish(reply *RPCMessage, err error) {
+	call.once.Do(func() {
+		call.reply = reply
+		call.err = err
+		close(call.done)
+	})
+
+	call.locker.Lock()
+	if call.timer != nil {
+		call.timer.Stop()
+	}
+	call.locker.Unlock()
+}
@@ -0,0 +1,211 @@
+package myrpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CallOption configures a single call of RPCClient
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	groupID      string
+	groupIDField string
+	dedupID      string
+	idempotency  string
+	delay        time.Duration
+	deliverAt    time.Time
+	ttl          time.Duration
+	expireAt     time.Time
+	compression  *string
+	priority     Priority
+	topic        string
+	replyTo      string
+	metadata     map[string]string
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	co := &callOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	return co
+}
+
+// WithMessageGroupID sets message group id of the message.
+// Messages in same group are delivered and processed in order on FIFO queue.
+func WithMessageGroupID(groupID string) CallOption {
+	return func(co *callOptions) {
+		co.groupID = groupID
+	}
+}
+
+// WithMessageGroupField takes message group id from given field of the payload.
+// The field is looked up by its Go name first, then by its json tag name.
+func WithMessageGroupField(field string) CallOption {
+	return func(co *callOptions) {
+		co.groupIDField = field
+	}
+}
+
+// WithDeduplicationID sets deduplication id of the message on FIFO queue
+func WithDeduplicationID(dedupID string) CallOption {
+	return func(co *callOptions) {
+		co.dedupID = dedupID
+	}
+}
+
+// WithIdempotencyKey derives id of the message from given key, instead of a random one,
+// so a retry of the same operation is skipped by server with dedup store, see RPCServer.UseDedupStore.
+// Concurrent synchronous calls must not share a key.
+func WithIdempotencyKey(key string) CallOption {
+	return func(co *callOptions) {
+		co.idempotency = key
+	}
+}
+
+// WithDelay delays handling of the message by given duration from the time message is created,
+// so an option built once could be used for many calls
+func WithDelay(delay time.Duration) CallOption {
+	return func(co *callOptions) {
+		co.delay, co.deliverAt = delay, time.Time{}
+	}
+}
+
+// WithDeliverAt delays handling of the message until given time
+func WithDeliverAt(t time.Time) CallOption {
+	return func(co *callOptions) {
+		co.delay, co.deliverAt = 0, t
+	}
+}
+
+// WithTTL makes the message expire after given duration from its delivery time,
+// so it is not handled if it arrives later, see RPCMessage.Deadline
+func WithTTL(ttl time.Duration) CallOption {
+	return func(co *callOptions) {
+		co.ttl = ttl
+	}
+}
+
+// WithExpireAt makes the message expire at given time, so it is not handled if it arrives later
+func WithExpireAt(t time.Time) CallOption {
+	return func(co *callOptions) {
+		co.expireAt = t
+	}
+}
+
+// WithPriority sends the message to lane of given priority, see PrioritySender
+func WithPriority(p Priority) CallOption {
+	return func(co *callOptions) {
+		co.priority = p
+	}
+}
+
+// withTopic sets topic of the message, see RPCClient.Publish
+func withTopic(topic string) CallOption {
+	return func(co *callOptions) {
+		co.topic = topic
+	}
+}
+
+// withReplyTo sets queue that reply of the message is sent to, see RPCClient.UseReplyQueue
+func withReplyTo(replyTo string) CallOption {
+	return func(co *callOptions) {
+		co.replyTo = replyTo
+	}
+}
+
+// WithCompression compresses payload by given algorithm regardless of its size.
+// Empty name disables compression for the call.
+func WithCompression(name string) CallOption {
+	return func(co *callOptions) {
+		co.compression = &name
+	}
+}
+
+// WithMetadata adds given key and value to metadata of the message
+func WithMetadata(key, value string) CallOption {
+	return func(co *callOptions) {
+		if co.metadata == nil {
+			co.metadata = make(map[string]string)
+		}
+		co.metadata[key] = value
+	}
+}
+
+// apply sets all options to given message
+func (co *callOptions) apply(msg *RPCMessage, in interface{}) error {
+	msg.GroupID = co.groupID
+	if co.groupIDField != "" {
+		groupID, err := fieldValue(in, co.groupIDField)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get message group id from field %s", co.groupIDField)
+		}
+		msg.GroupID = groupID
+	}
+	msg.DedupID = co.dedupID
+	if co.idempotency != "" {
+		msg.ID = idempotencyID(msg.SvrName, msg.MthName, co.idempotency)
+	}
+	msg.Priority = co.priority
+	msg.Topic = co.topic
+	msg.ReplyTo = co.replyTo
+	if len(co.metadata) > 0 {
+		msg.Metadata = co.metadata
+	}
+	if co.delay > 0 {
+		msg.DeliverAt = msg.Timestamp + int64(co.delay)
+	}
+	if !co.deliverAt.IsZero() {
+		msg.DeliverAt = co.deliverAt.UnixNano()
+	}
+	if co.ttl > 0 {
+		msg.Deadline = earliest(msg.Deadline, msgStart(msg)+int64(co.ttl))
+	}
+	if !co.expireAt.IsZero() {
+		msg.Deadline = earliest(msg.Deadline, co.expireAt.UnixNano())
+	}
+
+	return nil
+}
+
+// fieldValue returns value of given field of struct data in string format
+func fieldValue(data interface{}, field string) (string, error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", errors.New("nil payload")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("payload is not a struct: %T", data)
+	}
+
+	fv := v.FieldByName(field)
+	if !fv.IsValid() {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag == field {
+				fv = v.Field(i)
+				break
+			}
+		}
+	}
+	if !fv.IsValid() || !fv.CanInterface() {
+		return "", fmt.Errorf("no exported field %s in %T", field, data)
+	}
+
+	value := fmt.Sprint(fv.Interface())
+	if value == "" {
+		return "", fmt.Errorf("empty value of field %s", field)
+	}
+
+	return value, nil
+}
@@ -2,26 +2,63 @@ package myrpc
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
 // MessageSender is the interface to send a message service
 type MessageSender interface {
-	// SendAsyncMsg is called in case of publish/subscribe pattern
+	// SendAsyncMsg is called in case of fire-and-forget pattern, to a single consumer.
+	// See Publisher for publish/subscribe pattern.
 	SendAsyncMsg(msg *RPCMessage) error
 	// SendSyncMsg is called in case of request/reply pattern
 	SendSyncMsg(in *RPCMessage, out interface{}) error
 }
 
+// ContextSender is the interface of message sender that sends message within context of each call,
+// so the send could be canceled. Other senders send within their own context.
+type ContextSender interface {
+	SendAsyncMsgContext(ctx context.Context, msg *RPCMessage) error
+}
+
+// DelayedMessageSender is the interface of message sender that supports delayed delivery
+type DelayedMessageSender interface {
+	MessageSender
+	// SendDelayedMsg sends message that is delivered after given delay
+	SendDelayedMsg(msg *RPCMessage, delay time.Duration) error
+	// MaxDelay returns maximum delay that is supported by the sender
+	MaxDelay() time.Duration
+}
+
 // PayloadEncodeFnc encodes data to bytes
 type PayloadEncodeFnc func(data interface{}) ([]byte, error)
 
 // RPCClient represents client of this RPC
 type RPCClient struct {
 	sender        MessageSender
+	publisher     Publisher
 	ctx           context.Context
 	payloadEncode PayloadEncodeFnc
+	blobStore     BlobStore
+	blobThreshold int
+	compression   string
+	compressAbove int
+	keyProvider   KeyProvider
+	signer        Signer
+	verifier      Verifier
+	identity      Identity
+	logger        Logger
+	metrics       Metrics
+	tracer        Tracer
+	replies       *replyListener
+	replyTimeout  time.Duration
+	replyDecode   PayloadDecodeFnc
+	outbox        *SQLOutbox
 }
 
 // NewRPCClient returns new client from config
@@ -30,6 +67,11 @@ func NewRPCClient(ctx context.Context, sender MessageSender) *RPCClient {
 		sender:        sender,
 		ctx:           ctx,
 		payloadEncode: json.Marshal,
+		logger:        NopLogger(),
+		metrics:       NopMetrics{},
+		tracer:        NopTracer(),
+		replyTimeout:  DefaultReplyTimeout,
+		replyDecode:   json.Unmarshal,
 	}
 }
 
@@ -38,46 +80,425 @@ func (c *RPCClient) ReplacePayloadEncoder(encFnc PayloadEncodeFnc) {
 	c.payloadEncode = encFnc
 }
 
+// SetLogger replaces logger of rpc client
+func (c *RPCClient) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+// SetMetrics replaces metrics of rpc client
+func (c *RPCClient) SetMetrics(metrics Metrics) {
+	c.metrics = metrics
+}
+
+// SetTracer replaces tracer of rpc client
+func (c *RPCClient) SetTracer(tracer Tracer) {
+	c.tracer = tracer
+}
+
+// UseBlobStore makes client offload payload to given blob store
+// when encoded message is larger than threshold in bytes.
+// If threshold is not positive, DefaultBlobThreshold is used.
+func (c *RPCClient) UseBlobStore(store BlobStore, threshold int) {
+	if threshold <= 0 {
+		threshold = DefaultBlobThreshold
+	}
+	c.blobStore = store
+	c.blobThreshold = threshold
+}
+
+// UseCompression makes client compress payload by given algorithm
+// when payload is larger than threshold in bytes
+func (c *RPCClient) UseCompression(name string, threshold int) error {
+	if _, ok := CompressorByName(name); !ok {
+		return errors.Errorf("unknown compression: %s", name)
+	}
+	c.compression = name
+	c.compressAbove = threshold
+
+	return nil
+}
+
+// UseEncryption makes client encrypt payload of all messages
+// by data keys from given key provider, and decrypt payload of replies by it
+func (c *RPCClient) UseEncryption(kp KeyProvider) {
+	c.keyProvider = kp
+}
+
+// UseSigner makes client sign all messages by given signer
+func (c *RPCClient) UseSigner(signer Signer) {
+	c.signer = signer
+}
+
+// UseVerifier makes client verify signature of all replies, see RPCServer.UseSigner.
+// Call of unsigned or invalid reply fails.
+func (c *RPCClient) UseVerifier(verifier Verifier) {
+	c.verifier = verifier
+}
+
+// UseIdentity makes client send given identity in metadata of all messages.
+// Messages should be signed, so server could trust the identity.
+func (c *RPCClient) UseIdentity(principal string, roles ...string) {
+	c.identity = Identity{Principal: principal, Roles: roles}
+}
+
+// UsePublisher makes client publish messages to topics by given publisher, see Publish
+func (c *RPCClient) UsePublisher(p Publisher) {
+	c.publisher = p
+}
+
+// UseReplyQueue makes client receive replies of synchronous calls from given reply queue,
+// by a single loop until context of client is done. The replyTo is the address of the queue
+// that server sends replies to, such as queue url on SQS, see ReplySender.
+// The reply queue should be owned by this client only.
+func (c *RPCClient) UseReplyQueue(replyTo string, mr MessageReceiver, md MessageDeleter) {
+	c.replies = &replyListener{
+		client:   c,
+		replyTo:  replyTo,
+		receiver: mr,
+		deleter:  md,
+		pending:  make(map[string]func(reply *RPCMessage)),
+	}
+	go c.replies.listen(c.ctx)
+}
+
+// SetReplyTimeout replaces time to wait for reply of synchronous call, DefaultReplyTimeout by default
+func (c *RPCClient) SetReplyTimeout(timeout time.Duration) {
+	c.replyTimeout = timeout
+}
+
+// UseOutbox makes SendAsyncMsgTx write messages to given outbox.
+// Messages are sent by relay of outbox, see SQLOutbox.Relay. If client signs messages,
+// outbox signs them at relay by its own signer, see SQLOutbox.SetSigner.
+func (c *RPCClient) UseOutbox(outbox *SQLOutbox) {
+	c.outbox = outbox
+}
+
+// ReplaceReplyDecoder replaces decode function of reply payloads
+func (c *RPCClient) ReplaceReplyDecoder(decFnc PayloadDecodeFnc) {
+	c.replyDecode = decFnc
+}
+
 // SendAsyncMsg sends message to message service asynchronously,
 // that means no waiting response from server.
 // If no encodeFnc given, use client default encode instead.
-func (c *RPCClient) SendAsyncMsg(svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc) error {
-	if encodeFnc == nil {
-		// fallback to client default encode func
-		encodeFnc = c.payloadEncode
+func (c *RPCClient) SendAsyncMsg(svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	return c.SendAsyncMsgContext(c.ctx, svr, mth, in, encodeFnc, opts...)
+}
+
+// SendAsyncMsgContext is SendAsyncMsg within given ctx.
+// Deadline of ctx is sent as deadline of message, see RPCMessage.Deadline.
+func (c *RPCClient) SendAsyncMsgContext(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	ctx, span := c.tracer.StartProducer(ctx, svr, mth)
+	rpcMsg, err := c.newRPCMsg(ctx, svr, mth, in, encodeFnc, opts)
+	if err != nil {
+		span.End(err)
+		return err
 	}
 
-	payload, err := encodeFnc(in)
+	start := time.Now()
+	err = sendMsgContext(ctx, c.sender, rpcMsg)
+	c.observeSent(rpcMsg, start, err)
+	span.End(err)
 	if err != nil {
-		return errors.Wrapf(err, "cannot encode payload: %+v", in)
+		c.discardBlob(rpcMsg)
 	}
 
-	rpcMsg := RPCMessage{
-		SvrName: svr,
-		MthName: mth,
-		Payload: payload,
+	return err
+}
+
+// SendAsyncMsgTx writes message to outbox of client in given transaction, instead of sending it,
+// so it is sent by relay of outbox if and only if the transaction commits. See UseOutbox.
+// Message is stamped and signed at relay, so signing client requires signer of outbox, see SQLOutbox.SetSigner.
+// Offloaded payload is not deleted if the transaction is rolled back, so expire blobs in blob store,
+// such as by lifecycle rule of S3 bucket.
+// If no encodeFnc given, use client default encode instead.
+func (c *RPCClient) SendAsyncMsgTx(tx *sql.Tx, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	if c.outbox == nil {
+		return errors.New("no outbox of client, see UseOutbox")
+	}
+	if c.signer != nil && c.outbox.signer == nil {
+		return errors.New("no signer of outbox of signing client, see SQLOutbox.SetSigner")
+	}
+
+	ctx, span := c.tracer.StartProducer(c.ctx, svr, mth)
+	rpcMsg, err := c.newRPCMsg(ctx, svr, mth, in, encodeFnc, opts)
+	if err != nil {
+		span.End(err)
+		return err
+	}
+
+	err = c.outbox.Enqueue(tx, rpcMsg)
+	span.End(err)
+	if err != nil {
+		c.discardBlob(rpcMsg)
+		return err
+	}
+	c.logger.Debug("enqueued message to outbox", msgFields(rpcMsg)...)
+
+	return nil
+}
+
+// Publish publishes message to given topic once, and every consumer group subscribed
+// to the topic receives its own copy. Published message has topic as its service name.
+// If no encodeFnc given, use client default encode instead.
+func (c *RPCClient) Publish(topic string, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	return c.PublishContext(c.ctx, topic, in, encodeFnc, opts...)
+}
+
+// PublishContext is Publish within given ctx.
+// Deadline of ctx is sent as deadline of message, see RPCMessage.Deadline.
+func (c *RPCClient) PublishContext(ctx context.Context, topic string, in interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	if c.publisher == nil {
+		return errors.New("no publisher of client, see UsePublisher")
+	}
+
+	svr := ServiceName(topic)
+	ctx, span := c.tracer.StartProducer(ctx, svr, "")
+	opts = append(append([]CallOption{}, opts...), withTopic(topic))
+	rpcMsg, err := c.newRPCMsg(ctx, svr, "", in, encodeFnc, opts)
+	if err != nil {
+		span.End(err)
+		return err
+	}
+	if rpcMsg.DeliverAt != 0 {
+		err := errors.New("delayed delivery is not supported on publish")
+		span.End(err)
+		c.discardBlob(rpcMsg)
+		return err
+	}
+
+	start := time.Now()
+	if cp, ok := c.publisher.(ContextPublisher); ok {
+		err = cp.PublishContext(ctx, topic, rpcMsg)
+	} else {
+		err = c.publisher.Publish(topic, rpcMsg)
+	}
+	c.observeSent(rpcMsg, start, err)
+	span.End(err)
+	if err != nil {
+		c.discardBlob(rpcMsg)
 	}
 
-	return c.sender.SendAsyncMsg(&rpcMsg)
+	return err
 }
 
 // SendSyncMsg sends message to message service synchronously,
-// that means it is blocked until received response from server
-func (c *RPCClient) SendSyncMsg(svr ServiceName, mth MethodName, in interface{}, out interface{}, encodeFnc PayloadEncodeFnc) error {
+// that means it is blocked until received response from server.
+// If client has reply queue, the request is sent asynchronously and reply is received from reply queue,
+// otherwise the sender itself must support request/reply pattern.
+func (c *RPCClient) SendSyncMsg(svr ServiceName, mth MethodName, in interface{}, out interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	return c.SendSyncMsgContext(c.ctx, svr, mth, in, out, encodeFnc, opts...)
+}
+
+// SendSyncMsgContext is SendSyncMsg within given ctx, that stops waiting for reply when ctx is done.
+// Deadline of ctx is sent as deadline of message, see RPCMessage.Deadline.
+func (c *RPCClient) SendSyncMsgContext(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, out interface{}, encodeFnc PayloadEncodeFnc, opts ...CallOption) error {
+	if c.replies != nil {
+		call := c.startCall(ctx, svr, mth, in, encodeFnc, opts)
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			call.cancel(ctx.Err())
+		}
+		return call.Result(out)
+	}
+
+	ctx, span := c.tracer.StartProducer(ctx, svr, mth)
+	rpcMsg, err := c.newRPCMsg(ctx, svr, mth, in, encodeFnc, opts)
+	if err != nil {
+		span.End(err)
+		return err
+	}
+	if rpcMsg.DeliverAt != 0 {
+		err := errors.New("delayed delivery is not supported on synchronous call")
+		span.End(err)
+		c.discardBlob(rpcMsg)
+		return err
+	}
+
+	start := time.Now()
+	err = c.sender.SendSyncMsg(rpcMsg, out)
+	c.observeSent(rpcMsg, start, err)
+	span.End(err)
+	if err != nil {
+		c.discardBlob(rpcMsg)
+	}
+
+	return err
+}
+
+// observeSent logs and records metrics of sent message
+func (c *RPCClient) observeSent(msg *RPCMessage, start time.Time, err error) {
+	c.metrics.MsgSent(msg.SvrName, msg.MthName, time.Since(start), err)
+	if err != nil {
+		c.logger.Error("cannot send message", msgFields(msg, latencyField(start), errField(err))...)
+		return
+	}
+	c.logger.Debug("sent message", msgFields(msg, latencyField(start))...)
+}
+
+// newRPCMsg encodes given payload and builds message with given call options.
+// Span context of ctx is injected into message.
+func (c *RPCClient) newRPCMsg(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts []CallOption) (*RPCMessage, error) {
 	if encodeFnc == nil {
+		// fallback to client default encode func
 		encodeFnc = c.payloadEncode
 	}
 
 	payload, err := encodeFnc(in)
 	if err != nil {
-		return errors.Wrapf(err, "cannot encode payload: %+v", in)
+		return nil, errors.Wrapf(err, "cannot encode payload of type %T", in)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot send %s/%s", svr, mth)
 	}
 
 	rpcMsg := RPCMessage{
-		SvrName: svr,
-		MthName: mth,
-		Payload: payload,
+		ID:        newID(),
+		SvrName:   svr,
+		MthName:   mth,
+		Payload:   payload,
+		Timestamp: time.Now().UnixNano(),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		rpcMsg.Deadline = deadline.UnixNano()
+	}
+
+	co := newCallOptions(c.identityOpts(opts))
+	if err := co.apply(&rpcMsg, in); err != nil {
+		return nil, errors.Wrap(err, "cannot apply call options")
+	}
+	c.tracer.Inject(ctx, &rpcMsg)
+
+	compression := ""
+	if co.compression != nil {
+		compression = *co.compression
+	} else if c.compression != "" && len(payload) > c.compressAbove {
+		compression = c.compression
+	}
+	if compression != "" {
+		if err := compressPayload(&rpcMsg, compression); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.keyProvider != nil {
+		if err := encryptPayload(&rpcMsg, c.keyProvider); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.signMsg(&rpcMsg); err != nil {
+		return nil, err
+	}
+	// measured after signing, as signature is part of the sent message
+	offloaded, err := c.offloadPayload(&rpcMsg)
+	if err != nil {
+		return nil, err
+	}
+	if offloaded {
+		if err := c.signMsg(&rpcMsg); err != nil {
+			c.discardBlob(&rpcMsg)
+			return nil, err
+		}
+	}
+
+	return &rpcMsg, nil
+}
+
+// signMsg signs given message by signer of client, if any
+func (c *RPCClient) signMsg(msg *RPCMessage) error {
+	if c.signer == nil {
+		return nil
+	}
+
+	return signMsg(msg, c.signer)
+}
+
+// identityOpts appends identity of client to given call options,
+// so identity could not be overridden by metadata of a call
+func (c *RPCClient) identityOpts(opts []CallOption) []CallOption {
+	if c.identity.Principal == "" && len(c.identity.Roles) == 0 {
+		return opts
+	}
+
+	idOpts := []CallOption{WithMetadata(MetadataPrincipal, c.identity.Principal)}
+	if len(c.identity.Roles) > 0 {
+		idOpts = append(idOpts, WithMetadata(MetadataRoles, strings.Join(c.identity.Roles, ",")))
+	}
+
+	return append(append([]CallOption{}, opts...), idOpts...)
+}
+
+// offloadPayload moves payload of given message to blob store,
+// in case encoded message is over the threshold. It reports whether payload is offloaded.
+func (c *RPCClient) offloadPayload(msg *RPCMessage) (bool, error) {
+	if c.blobStore == nil {
+		return false, nil
+	}
+
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot convert msg to json: %+v", msg)
+	}
+	if len(msgJSON) <= c.blobThreshold {
+		return false, nil
+	}
+
+	key := newID()
+	if err := c.blobStore.PutBlob(key, msg.Payload); err != nil {
+		return false, errors.Wrapf(err, "cannot offload payload of %s/%s", msg.SvrName, msg.MthName)
+	}
+	digest := sha256.Sum256(msg.Payload)
+	msg.Payload = nil
+	msg.PayloadRef = key
+	msg.PayloadDigest = digest[:]
+
+	return true, nil
+}
+
+// discardBlob deletes offloaded payload of message that is not sent, so the blob is not orphaned
+func (c *RPCClient) discardBlob(msg *RPCMessage) {
+	if msg.PayloadRef == "" {
+		return
+	}
+	if err := c.blobStore.DeleteBlob(msg.PayloadRef); err != nil {
+		c.logger.Error("cannot delete offloaded payload of unsent message", msgFields(msg, errField(err))...)
+	}
+}
+
+// sendMsg sends message asynchronously, respecting its delivery time.
+// Delay longer than maximum delay of the sender is capped,
+// and the rest of delay is handled by re-enqueueing on server side.
+func sendMsg(sender MessageSender, msg *RPCMessage) error {
+	delay := msg.remainingDelay()
+	if delay <= 0 {
+		return sender.SendAsyncMsg(msg)
+	}
+
+	return sendMsgWithDelay(sender, msg, delay)
+}
+
+// sendMsgContext is sendMsg within given ctx, if the sender supports it
+func sendMsgContext(ctx context.Context, sender MessageSender, msg *RPCMessage) error {
+	cs, ok := sender.(ContextSender)
+	if !ok || msg.remainingDelay() > 0 {
+		return sendMsg(sender, msg)
+	}
+
+	return cs.SendAsyncMsgContext(ctx, msg)
+}
+
+// sendMsgWithDelay sends message with given delay, capped at maximum delay of the sender
+func sendMsgWithDelay(sender MessageSender, msg *RPCMessage, delay time.Duration) error {
+	ds, ok := sender.(DelayedMessageSender)
+	if !ok {
+		return errors.Errorf("sender %T does not support delayed delivery", sender)
+	}
+	if maxDelay := ds.MaxDelay(); delay > maxDelay {
+		delay = maxDelay
 	}
 
-	return c.sender.SendSyncMsg(&rpcMsg, out)
+	return ds.SendDelayedMsg(msg, delay)
 }
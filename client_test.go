@@ -0,0 +1,130 @@
+package myrpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tempDir returns a new temporary directory, that caller removes
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "myrpc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+type failingSender struct{}
+
+func (failingSender) SendAsyncMsg(msg *RPCMessage) error {
+	return errors.New("send failed")
+}
+
+func (failingSender) SendSyncMsg(in *RPCMessage, out interface{}) error {
+	return errors.New("send failed")
+}
+
+func TestOffloadMeasuresSignedMessage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRPCClient(context.Background(), NewMemoryQueue())
+	c.UseSigner(NewHMACSigner("k1", []byte("secret")))
+
+	unsigned := RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", Payload: []byte(strings.Repeat("a", 1000))}
+	unsignedJSON, _ := unsigned.ToJSON()
+	// message fits the threshold only without its signature
+	c.UseBlobStore(store, len(unsignedJSON)+50)
+
+	msg, err := c.newRPCMsg(context.Background(), "svc", "mth", strings.Repeat("a", 1000), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.PayloadRef == "" {
+		t.Fatal("payload of message over threshold after signing is not offloaded")
+	}
+	if err := verifyMsg(msg, NewHMACVerifier(map[string][]byte{"k1": []byte("secret")}), 0); err != nil {
+		t.Fatalf("offloaded message is not signed again: %v", err)
+	}
+}
+
+func TestBlobDeletedOnSendFailure(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRPCClient(context.Background(), failingSender{})
+	c.UseBlobStore(store, 10)
+
+	if err := c.SendAsyncMsg("svc", "mth", strings.Repeat("a", 100), nil); err == nil {
+		t.Fatal("expected send error")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("blob of unsent message is not deleted: %d files left", len(files))
+	}
+}
+
+func TestDelayFromCreationOfMsg(t *testing.T) {
+	const created = int64(1000 * time.Second)
+	at := time.Unix(0, created).Add(2 * time.Hour)
+	tests := []struct {
+		name         string
+		opts         []CallOption
+		wantDeliver  int64
+		wantDeadline int64
+	}{
+		{"delay", []CallOption{WithDelay(time.Hour)}, created + int64(time.Hour), 0},
+		{"deliver at", []CallOption{WithDeliverAt(at)}, at.UnixNano(), 0},
+		{"later deliver at wins", []CallOption{WithDelay(time.Hour), WithDeliverAt(at)}, at.UnixNano(), 0},
+		{"later delay wins", []CallOption{WithDeliverAt(at), WithDelay(time.Hour)}, created + int64(time.Hour), 0},
+		{"ttl from delivery", []CallOption{WithTTL(time.Minute), WithDelay(time.Hour)},
+			created + int64(time.Hour), created + int64(time.Hour+time.Minute)},
+		{"ttl without delay", []CallOption{WithTTL(time.Minute)}, 0, created + int64(time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &RPCMessage{Timestamp: created}
+			if err := newCallOptions(tt.opts).apply(msg, nil); err != nil {
+				t.Fatal(err)
+			}
+			if msg.DeliverAt != tt.wantDeliver || msg.Deadline != tt.wantDeadline {
+				t.Errorf("deliver at %d, deadline %d, want %d, %d", msg.DeliverAt, msg.Deadline, tt.wantDeliver, tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestDelayOptionReused(t *testing.T) {
+	sender := &recordingSender{}
+	c := NewRPCClient(context.Background(), sender)
+	delay := WithDelay(time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := c.SendAsyncMsg("svc", "mth", "payload", rawEncode, delay); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, msg := range sender.msgs {
+		if msg.DeliverAt-msg.Timestamp != int64(time.Hour) {
+			t.Errorf("message is delivered %s after it is created, want 1h", time.Duration(msg.DeliverAt-msg.Timestamp))
+		}
+	}
+	if len(sender.msgs) != 2 || sender.msgs[0].DeliverAt == sender.msgs[1].DeliverAt {
+		t.Errorf("messages sent by the same option are delivered at the same time")
+	}
+}
@@ -0,0 +1,201 @@
+package myrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Names of built-in compression algorithms
+const (
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// MaxDecompressedSize is the maximum size of payload decompressed by built-in algorithms,
+// so a small payload from the queue could not exhaust memory when it is decompressed
+const MaxDecompressedSize = 64 << 20
+
+// errDecompressedSize is returned when decompressed payload exceeds maximum size
+var errDecompressedSize = errors.New("decompressed payload exceeds maximum size")
+
+// Compressor is the interface to compress and decompress payload.
+// Name of the compressor is recorded in message,
+// so server could decompress payload with the same algorithm.
+// Payload comes from the queue, so Decompress should bound size of its output.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	compressorsLocker sync.RWMutex
+	compressors       = map[string]Compressor{
+		CompressionGzip:   gzipCompressor{maxSize: MaxDecompressedSize},
+		CompressionZstd:   newZstdCompressor(MaxDecompressedSize),
+		CompressionSnappy: snappyCompressor{maxSize: MaxDecompressedSize},
+	}
+)
+
+// RegisterCompressor adds compressor to registry of both client and server,
+// replacing the registered one with the same name
+func RegisterCompressor(c Compressor) {
+	compressorsLocker.Lock()
+	compressors[c.Name()] = c
+	compressorsLocker.Unlock()
+}
+
+// CompressorByName returns registered compressor by its name
+func CompressorByName(name string) (Compressor, bool) {
+	compressorsLocker.RLock()
+	c, ok := compressors[name]
+	compressorsLocker.RUnlock()
+
+	return c, ok
+}
+
+// compressPayload compresses payload of message by given algorithm.
+// Payload is kept as it is if compressed one is not smaller.
+func compressPayload(msg *RPCMessage, name string) error {
+	c, ok := CompressorByName(name)
+	if !ok {
+		return errors.Errorf("unknown compression: %s", name)
+	}
+
+	compressed, err := c.Compress(msg.Payload)
+	if err != nil {
+		return errors.Wrapf(err, "cannot compress payload by %s", name)
+	}
+	if len(compressed) >= len(msg.Payload) {
+		return nil
+	}
+	msg.Payload = compressed
+	msg.Compression = name
+
+	return nil
+}
+
+// decompressPayload decompresses payload by algorithm of given name
+func decompressPayload(name string, payload []byte) ([]byte, error) {
+	if name == "" {
+		return payload, nil
+	}
+
+	c, ok := CompressorByName(name)
+	if !ok {
+		return nil, errors.Errorf("unknown compression: %s", name)
+	}
+
+	data, err := c.Decompress(payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decompress payload by %s", name)
+	}
+
+	return data, nil
+}
+
+type gzipCompressor struct {
+	maxSize int
+}
+
+func (gzipCompressor) Name() string {
+	return CompressionGzip
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gc gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// read one more byte than maximum to detect oversize payload
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, int64(gc.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > gc.maxSize {
+		return nil, errDecompressedSize
+	}
+
+	return decompressed, nil
+}
+
+// zstdCompressor shares one encoder and one decoder, both are safe for concurrent use
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	maxSize int
+}
+
+func newZstdCompressor(maxSize int) *zstdCompressor {
+	// creating encoder/decoder without writer/reader and with valid options never fails
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+
+	return &zstdCompressor{encoder: encoder, decoder: decoder, maxSize: maxSize}
+}
+
+func (*zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (zc *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return zc.encoder.EncodeAll(data, nil), nil
+}
+
+func (zc *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	decompressed, err := zc.decoder.DecodeAll(data, nil)
+	// window larger than maximum size is refused too, as it is allocated on decoding
+	if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded || len(decompressed) > zc.maxSize {
+		return nil, errDecompressedSize
+	}
+
+	return decompressed, err
+}
+
+type snappyCompressor struct {
+	maxSize int
+}
+
+func (snappyCompressor) Name() string {
+	return CompressionSnappy
+}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (sc snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	// snappy payload records its decoded size, which is allocated by Decode
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > sc.maxSize {
+		return nil, errDecompressedSize
+	}
+
+	return snappy.Decode(nil, data)
+}
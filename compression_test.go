@@ -0,0 +1,68 @@
+package myrpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	payload := []byte(strings.Repeat("payload of message ", 100))
+	for _, name := range []string{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(name, func(t *testing.T) {
+			c, ok := CompressorByName(name)
+			if !ok {
+				t.Fatalf("no compressor %s", name)
+			}
+			compressed, err := c.Compress(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decompressed, err := c.Decompress(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompressed, payload) {
+				t.Error("decompressed payload differs")
+			}
+		})
+	}
+}
+
+func TestDecompressOverLimit(t *testing.T) {
+	const maxSize = 64 << 10
+	zc := newZstdCompressor(maxSize)
+	// window of default encoder is larger than maximum size of test
+	zc.encoder, _ = zstd.NewWriter(nil, zstd.WithWindowSize(zstd.MinWindowSize))
+	tests := []struct {
+		name string
+		c    Compressor
+	}{
+		{name: CompressionGzip, c: gzipCompressor{maxSize: maxSize}},
+		{name: CompressionZstd, c: zc},
+		{name: CompressionSnappy, c: snappyCompressor{maxSize: maxSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// zeros compress to a tiny payload
+			for size, wantErr := range map[int]bool{maxSize: false, maxSize + 1: true, 100 * maxSize: true} {
+				compressed, err := tt.c.Compress(make([]byte, size))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decompressed, err := tt.c.Decompress(compressed)
+				if wantErr {
+					if err != errDecompressedSize {
+						t.Errorf("payload of %d bytes is decompressed, error %v", size, err)
+					}
+					continue
+				}
+				if err != nil || len(decompressed) != size {
+					t.Errorf("payload of %d bytes is decompressed to %d bytes, error %v", size, len(decompressed), err)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package myrpc
 import (
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -28,39 +29,227 @@ type DeleterConf struct {
 
 // QueueConf contains info about message queue
 type QueueConf struct {
+	// Transport is the message service of queue, TransportSQS by default
+	Transport          string `yaml:"transport"`
 	QueueRegion        string `yaml:"queue_region"`
 	QueueBaseURL       string `yaml:"queue_base_url"`
 	QueueName          string `yaml:"queue_name"`
 	AWSAccessKeyID     string `yaml:"aws_access_key_id"`
 	AWSSecretAccessKey string `yaml:"aws_secret_access_key"`
 	SessionToken       string `yaml:"sqs_session_token"`
+	// AWSRoleConf is used when static keys are not given
+	AWSRoleConf `yaml:",inline"`
+	// Attributes are applied by SQSProvisioner
+	Attributes QueueAttributesConf `yaml:"attributes"`
+}
+
+// QueueAttributesConf contains attributes of queue.
+// Zero values are left as they are on the queue.
+// Queue is FIFO if its name has suffix ".fifo".
+type QueueAttributesConf struct {
+	// VisibilityTimeout is in seconds
+	VisibilityTimeout int64 `yaml:"visibility_timeout"`
+	// MessageRetentionPeriod is in seconds
+	MessageRetentionPeriod    int64 `yaml:"message_retention_period"`
+	ContentBasedDeduplication bool  `yaml:"content_based_deduplication"` // FIFO queue only
+	// DeadLetterQueue is name of queue in config that messages are moved to
+	// after MaxReceiveCount receives
+	DeadLetterQueue string `yaml:"dead_letter_queue"`
+	MaxReceiveCount int64  `yaml:"max_receive_count"`
+}
+
+// S3BlobStoreConf contains info about S3 or S3 compatible storage to offload large payloads
+type S3BlobStoreConf struct {
+	Region             string `yaml:"region"`
+	Endpoint           string `yaml:"endpoint"`
+	Bucket             string `yaml:"bucket"`
+	KeyPrefix          string `yaml:"key_prefix"`
+	ForcePathStyle     bool   `yaml:"force_path_style"` // required by MinIO
+	AWSAccessKeyID     string `yaml:"aws_access_key_id"`
+	AWSSecretAccessKey string `yaml:"aws_secret_access_key"`
+	SessionToken       string `yaml:"session_token"`
+	// AWSRoleConf is used when static keys are not given
+	AWSRoleConf `yaml:",inline"`
+}
+
+// TopicConf contains info about SNS topic that client publishes messages to, see NewSNSPublisher
+type TopicConf struct {
+	TopicARN           string `yaml:"topic_arn"`
+	Region             string `yaml:"region"`
+	Endpoint           string `yaml:"endpoint"`
+	AWSAccessKeyID     string `yaml:"aws_access_key_id"`
+	AWSSecretAccessKey string `yaml:"aws_secret_access_key"`
+	SessionToken       string `yaml:"session_token"`
+	// AWSRoleConf is used when static keys are not given
+	AWSRoleConf `yaml:",inline"`
+}
+
+// Transports of queue
+const (
+	TransportSQS = "sqs"
+)
+
+// Config is the unified config of server and client.
+// Queues are defined once, and referred by their name from other sections.
+type Config struct {
+	// Provision creates queues and corrects their attributes on building server or client
+	Provision bool                 `yaml:"provision"`
+	Queues    map[string]QueueConf `yaml:"queues"`
+	Server    ServerConf           `yaml:"server"`
+	Client    ClientConf           `yaml:"client"`
+	// Topics are topics that client publishes messages to, by name.
+	// Server receives published messages from queues subscribed to topics.
+	Topics map[string]TopicConf `yaml:"topics"`
+}
+
+// ServerConf contains info about config of RPC server
+type ServerConf struct {
+	// Queue is name of queue that server receives messages from
+	Queue             string    `yaml:"queue"`
+	NumMsgsPerReceive int64     `yaml:"number_messages_per_receive"`
+	VisibilityTimeout int64     `yaml:"visibility_timeout"`
+	WaitTimeSeconds   int64     `yaml:"wait_time_seconds"`
+	Concurrency       int       `yaml:"concurrency"`
+	Retry             RetryConf `yaml:"retry"`
+	// DeadLetterQueue is name of queue that rejected messages are sent to
+	DeadLetterQueue string    `yaml:"dead_letter_queue"`
+	Admin           AdminConf `yaml:"admin"`
+	// Queues are weights and concurrency limits of queues by name.
+	// Queues other than Queue are received from too.
+	Queues map[string]ServerQueueConf `yaml:"queues"`
+	// Priority lanes are received from too, if any
+	Priority PriorityConf `yaml:"priority"`
+	// ExpiredAction is what server does with expired messages, ExpiredDrop by default
+	ExpiredAction ExpiredAction `yaml:"expired_action"`
+	// Dedup makes server skip messages that are already handled, by their ID
+	Dedup DedupConf `yaml:"dedup"`
+}
+
+// PriorityConf contains info about priority lanes that server receives messages from,
+// by a PriorityReceiver that is served as one more queue
+type PriorityConf struct {
+	// Mode is PriorityStrict or PriorityWeighted, PriorityWeighted by default
+	Mode PriorityMode `yaml:"mode"`
+	// Lanes are from highest to lowest priority
+	Lanes []LaneConf `yaml:"lanes"`
+	// IdleWait is time to wait when all lanes are empty, DefaultPriorityIdleWait by default
+	IdleWait time.Duration `yaml:"idle_wait"`
+	// ServerQueueConf is weight and concurrency of lanes among other queues of server
+	ServerQueueConf `yaml:",inline"`
+}
+
+// LaneConf contains info about a priority lane
+type LaneConf struct {
+	Priority Priority `yaml:"priority"`
+	// Queue is name of queue of lane, received from without long polling
+	Queue  string `yaml:"queue"`
+	Weight int    `yaml:"weight"`
+}
+
+// ServerQueueConf contains info about a queue that server receives messages from
+type ServerQueueConf struct {
+	// Weight is share of server concurrency of queue, 1 by default
+	Weight int `yaml:"weight"`
+	// Concurrency limits workers of queue, instead of its share of server concurrency
+	Concurrency int `yaml:"concurrency"`
+}
+
+// RetryConf contains info about retry policy of failed messages
+type RetryConf struct {
+	// MaxAttempts is maximum number of times a message is handled before it is dead-lettered.
+	// 0 means server stops on the first failed message.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// ClientConf contains info about config of RPC client
+type ClientConf struct {
+	// Queue is name of queue that client sends messages to
+	Queue                string `yaml:"queue"`
+	Compression          string `yaml:"compression"`
+	CompressionThreshold int    `yaml:"compression_threshold"`
+	// Routes are names of queues that messages are sent to instead of Queue,
+	// by "Service" or "Service/Method" of message
+	Routes map[string]string `yaml:"routes"`
+	// Priorities are names of queues that messages are sent to by their priority, see WithPriority.
+	// Priorities take precedence over Routes.
+	Priorities map[string]string `yaml:"priorities"`
+	// ReplyQueue is name of queue that client receives replies of synchronous calls from.
+	// It should be owned by this client only.
+	ReplyQueue   string        `yaml:"reply_queue"`
+	ReplyTimeout time.Duration `yaml:"reply_timeout"`
+}
+
+// ConfigFromYamlFile returns Config from given yaml conf file,
+// overridden by environment variables, see Config.ApplyEnv
+func ConfigFromYamlFile(filePath string) (*Config, error) {
+	var c Config
+	if err := yamlFileToStruct(filePath, "config", &c); err != nil {
+		return nil, err
+	}
+
+	if err := c.ApplyEnv(os.Environ()); err != nil {
+		return nil, errors.Wrapf(err, "invalid environment variables for conf file: %s", filePath)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid conf file: %s", filePath)
+	}
+
+	return &c, nil
+}
+
+// SenderConf returns config of sender of client queue
+func (c *Config) SenderConf() SenderConf {
+	return SenderConf{Queue: c.Queues[c.Client.Queue]}
+}
+
+// ServerQueues returns names of all queues that server receives messages from, server queue first
+func (c *Config) ServerQueues() []string {
+	names := []string{c.Server.Queue}
+	for _, name := range sortedKeys(c.Server.Queues) {
+		if name != c.Server.Queue {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// ReceiverConf returns config of receiver of server queue
+func (c *Config) ReceiverConf() ReceiverConf {
+	return c.QueueReceiverConf(c.Server.Queue)
+}
+
+// QueueReceiverConf returns config of receiver of given queue, with receive settings of server
+func (c *Config) QueueReceiverConf(queue string) ReceiverConf {
+	return ReceiverConf{
+		Queue:             c.Queues[queue],
+		NumMsgsPerReceive: c.Server.NumMsgsPerReceive,
+		VisibilityTimeout: c.Server.VisibilityTimeout,
+		WaitTimeSeconds:   c.Server.WaitTimeSeconds,
+	}
+}
+
+// DeleterConf returns config of deleter of server queue
+func (c *Config) DeleterConf() DeleterConf {
+	return DeleterConf{Queue: c.Queues[c.Server.Queue]}
 }
 
 // ReceiverConfFromYamlFile returns ReceiverConf from given yaml conf file
 func ReceiverConfFromYamlFile(filePath string) (*ReceiverConf, error) {
 	var rc ReceiverConf
-	bytes, err := fileToBytes(filePath)
-	if err != nil {
-		return nil, errors.Wrapf(err, "invalid receiver conf file: %s", filePath)
-	}
-
-	if err := yaml.Unmarshal(bytes, &rc); err != nil {
-		return nil, errors.Wrapf(err, "cannot unmarshal receiver conf file: %s", filePath)
+	if err := yamlFileToStruct(filePath, "receiver", &rc); err != nil {
+		return nil, err
 	}
 
 	return &rc, nil
 }
 
-// SenderConfFromYamlFile returns DeleterConf from given yaml conf file
+// SenderConfFromYamlFile returns SenderConf from given yaml conf file
 func SenderConfFromYamlFile(filePath string) (*SenderConf, error) {
 	var sc SenderConf
-	bytes, err := fileToBytes(filePath)
-	if err != nil {
-		return nil, errors.Wrapf(err, "invalid sender conf file: %s", filePath)
-	}
-
-	if err := yaml.Unmarshal(bytes, &sc); err != nil {
-		return nil, errors.Wrapf(err, "cannot unmarshal sender conf file: %s", filePath)
+	if err := yamlFileToStruct(filePath, "sender", &sc); err != nil {
+		return nil, err
 	}
 
 	return &sc, nil
@@ -69,16 +258,35 @@ func SenderConfFromYamlFile(filePath string) (*SenderConf, error) {
 // DeleterConfFromYamlFile returns DeleterConf from given yaml conf file
 func DeleterConfFromYamlFile(filePath string) (*DeleterConf, error) {
 	var dc DeleterConf
+	if err := yamlFileToStruct(filePath, "deleter", &dc); err != nil {
+		return nil, err
+	}
+
+	return &dc, nil
+}
+
+// S3BlobStoreConfFromYamlFile returns S3BlobStoreConf from given yaml conf file
+func S3BlobStoreConfFromYamlFile(filePath string) (*S3BlobStoreConf, error) {
+	var bc S3BlobStoreConf
+	if err := yamlFileToStruct(filePath, "s3 blob store", &bc); err != nil {
+		return nil, err
+	}
+
+	return &bc, nil
+}
+
+// yamlFileToStruct unmarshals given yaml file of given kind of conf to out
+func yamlFileToStruct(filePath string, kind string, out interface{}) error {
 	bytes, err := fileToBytes(filePath)
 	if err != nil {
-		return nil, errors.Wrapf(err, "invalid deleter conf file: %s", filePath)
+		return errors.Wrapf(err, "invalid %s conf file: %s", kind, filePath)
 	}
 
-	if err := yaml.Unmarshal(bytes, &dc); err != nil {
-		return nil, errors.Wrapf(err, "cannot unmarshal deleter conf file: %s", filePath)
+	if err := yaml.Unmarshal(bytes, out); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal %s conf file: %s", kind, filePath)
 	}
 
-	return &dc, nil
+	return nil
 }
 
 func fileToBytes(filePath string) ([]byte, error) {
@@ -0,0 +1,236 @@
+package myrpc
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of environment variables that override config
+const EnvPrefix = "MYRPC"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnv overrides config by given environment variables in "key=value" form, such as os.Environ().
+// Name of variable is EnvPrefix followed by yaml keys of the field in upper case, joined by "_".
+// For example, MYRPC_SERVER_CONCURRENCY overrides server.concurrency,
+// MYRPC_QUEUES_MAIN_QUEUE_NAME overrides queues.main.queue_name,
+// and MYRPC_SERVER_PRIORITY_LANES_0_QUEUE overrides server.priority.lanes.0.queue.
+// Variables of undefined map keys and slice indices add them, and keys added so are in lower case.
+func (c *Config) ApplyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	var errs ValidationErrors
+	applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, "", env, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func applyEnv(v reflect.Value, envName, path string, env map[string]string, errs *ValidationErrors) {
+	switch {
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+			if len(tag) > 1 && tag[1] == "inline" {
+				applyEnv(v.Field(i), envName, path, env, errs)
+				continue
+			}
+			key := tag[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			applyEnv(v.Field(i), envName+"_"+envKey(key), joinPath(path, key), env, errs)
+		}
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		keys := append(sortedKeys(v.Interface()), newMapKeys(v, envName, env)...)
+		if v.IsNil() && len(keys) > 0 {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, k := range keys {
+			// map element is not addressable, so override a copy then put it back
+			key := reflect.ValueOf(k).Convert(v.Type().Key())
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if old := v.MapIndex(key); old.IsValid() {
+				elem.Set(old)
+			}
+			applyEnv(elem, envName+"_"+envKey(k), joinPath(path, k), env, errs)
+			v.SetMapIndex(key, elem)
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		if n := maxEnvIndex(envName, env) + 1; n > v.Len() {
+			grown := reflect.MakeSlice(v.Type(), n, n)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		for i := 0; i < v.Len(); i++ {
+			applyEnv(v.Index(i), envName+"_"+strconv.Itoa(i), joinPath(path, strconv.Itoa(i)), env, errs)
+		}
+	default:
+		value, ok := env[envName]
+		if !ok {
+			return
+		}
+		if err := setFromString(v, value); err != nil {
+			errs.add(path, "invalid value of %s: %v", envName, err)
+		}
+	}
+}
+
+// newMapKeys returns keys of given map that are not defined yet but have environment variables, in sorted order.
+// Key of a struct element is what precedes the longest name of a field of the element.
+func newMapKeys(v reflect.Value, envName string, env map[string]string) []string {
+	defined := make(map[string]bool, v.Len())
+	for _, k := range v.MapKeys() {
+		defined[envKey(k.String())] = true
+	}
+	suffixes := envSuffixes(v.Type().Elem(), "")
+	sort.Slice(suffixes, func(i, j int) bool { return len(suffixes[i]) > len(suffixes[j]) })
+
+	found := make(map[string]bool)
+	for name := range env {
+		rest := strings.TrimPrefix(name, envName+"_")
+		if rest == name || rest == "" {
+			continue
+		}
+		key := rest
+		if len(suffixes) > 0 {
+			key = ""
+			for _, s := range suffixes {
+				if strings.HasSuffix(rest, "_"+s) {
+					key = strings.TrimSuffix(rest, "_"+s)
+					break
+				}
+			}
+		}
+		if key != "" && !defined[key] {
+			found[strings.ToLower(key)] = true
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// envSuffixes returns names of leaf fields of given struct type, relative to the struct
+func envSuffixes(t reflect.Type, prefix string) []string {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var suffixes []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			suffixes = append(suffixes, envSuffixes(t.Field(i).Type, prefix)...)
+			continue
+		}
+		key := tag[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + envKey(key)
+		if sub := envSuffixes(t.Field(i).Type, name+"_"); len(sub) > 0 {
+			suffixes = append(suffixes, sub...)
+		} else {
+			suffixes = append(suffixes, name)
+		}
+	}
+
+	return suffixes
+}
+
+// maxEnvIndex returns the largest index of slice that has environment variables, or -1
+func maxEnvIndex(envName string, env map[string]string) int {
+	max := -1
+	for name := range env {
+		rest := strings.TrimPrefix(name, envName+"_")
+		if rest == name {
+			continue
+		}
+		if i := strings.IndexByte(rest, '_'); i > 0 {
+			if n, err := strconv.Atoi(rest[:i]); err == nil && n > max {
+				max = n
+			}
+		}
+	}
+
+	return max
+}
+
+// setFromString parses given string into value of field
+func setFromString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return &reflect.ValueError{Method: "setFromString", Kind: v.Kind()}
+		}
+		items := strings.Split(s, ",")
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			slice.Index(i).SetString(strings.TrimSpace(item))
+		}
+		v.Set(slice)
+	default:
+		return &reflect.ValueError{Method: "setFromString", Kind: v.Kind()}
+	}
+
+	return nil
+}
+
+// envKey converts yaml key into part of environment variable name
+func envKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
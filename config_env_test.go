@@ -0,0 +1,137 @@
+package myrpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func baseEnvConfig() Config {
+	return Config{
+		Queues: map[string]QueueConf{"main": {QueueName: "main", QueueRegion: "us-east-1"}},
+		Server: ServerConf{Queue: "main", Concurrency: 4},
+		Client: ClientConf{Queue: "main", Routes: map[string]string{"Echo": "main"}},
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    func(c *Config)
+	}{
+		{"no variables", nil, func(c *Config) {}},
+		{"unrelated variables", []string{"HOME=/root", "MYRPC", "=x"}, func(c *Config) {}},
+		{"int", []string{"MYRPC_SERVER_CONCURRENCY=16"}, func(c *Config) { c.Server.Concurrency = 16 }},
+		{"int64", []string{"MYRPC_SERVER_NUMBER_MESSAGES_PER_RECEIVE=10"}, func(c *Config) { c.Server.NumMsgsPerReceive = 10 }},
+		{"bool", []string{"MYRPC_PROVISION=true"}, func(c *Config) { c.Provision = true }},
+		{"duration", []string{"MYRPC_CLIENT_REPLY_TIMEOUT=1m30s"}, func(c *Config) { c.Client.ReplyTimeout = 90 * time.Second }},
+		{"named string", []string{"MYRPC_SERVER_EXPIRED_ACTION=dead_letter"}, func(c *Config) { c.Server.ExpiredAction = ExpiredDeadLetter }},
+		{"value with =", []string{"MYRPC_CLIENT_QUEUE=a=b"}, func(c *Config) { c.Client.Queue = "a=b" }},
+		{"inline struct", []string{"MYRPC_SERVER_PRIORITY_WEIGHT=3"}, func(c *Config) { c.Server.Priority.Weight = 3 }},
+		{"defined map key", []string{"MYRPC_QUEUES_MAIN_QUEUE_NAME=other"}, func(c *Config) {
+			c.Queues["main"] = QueueConf{QueueName: "other", QueueRegion: "us-east-1"}
+		}},
+		{"defined map key of leaf", []string{"MYRPC_CLIENT_ROUTES_ECHO=other"}, func(c *Config) { c.Client.Routes["Echo"] = "other" }},
+		{"new map key", []string{"MYRPC_QUEUES_DEAD_LETTER_QUEUE_NAME=dlq", "MYRPC_QUEUES_DEAD_LETTER_QUEUE_REGION=eu-west-1",
+			"MYRPC_QUEUES_DEAD_LETTER_ATTRIBUTES_MAX_RECEIVE_COUNT=5"}, func(c *Config) {
+			c.Queues["dead_letter"] = QueueConf{QueueName: "dlq", QueueRegion: "eu-west-1",
+				Attributes: QueueAttributesConf{MaxReceiveCount: 5}}
+		}},
+		{"new map key of leaf", []string{"MYRPC_CLIENT_PRIORITIES_HIGH=main"}, func(c *Config) {
+			c.Client.Priorities = map[string]string{"high": "main"}
+		}},
+		{"new map key of nil map", []string{"MYRPC_SERVER_QUEUES_MAIN_WEIGHT=2"}, func(c *Config) {
+			c.Server.Queues = map[string]ServerQueueConf{"main": {Weight: 2}}
+		}},
+		{"new slice indices", []string{"MYRPC_SERVER_PRIORITY_LANES_0_PRIORITY=high", "MYRPC_SERVER_PRIORITY_LANES_0_QUEUE=main",
+			"MYRPC_SERVER_PRIORITY_LANES_1_PRIORITY=low", "MYRPC_SERVER_PRIORITY_LANES_1_WEIGHT=1"}, func(c *Config) {
+			c.Server.Priority.Lanes = []LaneConf{{Priority: "high", Queue: "main"}, {Priority: "low", Weight: 1}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, want := baseEnvConfig(), baseEnvConfig()
+			tt.want(&want)
+			if err := c.ApplyEnv(tt.environ); err != nil {
+				t.Fatalf("ApplyEnv() error = %v", err)
+			}
+			if !reflect.DeepEqual(c, want) {
+				t.Errorf("ApplyEnv() = %+v, want %+v", c, want)
+			}
+		})
+	}
+}
+
+func TestSetFromString(t *testing.T) {
+	tests := []struct {
+		name    string
+		ptr     interface{}
+		s       string
+		want    interface{}
+		wantErr bool
+	}{
+		{"string", new(string), "a b", "a b", false},
+		{"duration", new(time.Duration), "1h2m", time.Hour + 2*time.Minute, false},
+		{"duration without unit", new(time.Duration), "10", time.Duration(0), true},
+		{"bool", new(bool), "1", true, false},
+		{"bool false", new(bool), "FALSE", false, false},
+		{"bad bool", new(bool), "on", false, true},
+		{"int", new(int), "-3", -3, false},
+		{"bad int", new(int), "3x", 0, true},
+		{"int64 overflow", new(int64), "9223372036854775808", int64(0), true},
+		{"list", new([]string), "a, b,c", []string{"a", "b", "c"}, false},
+		{"list of one", new([]string), "a", []string{"a"}, false},
+		{"unsupported", new(float64), "1.5", float64(0), true},
+		{"unsupported list", new([]int), "1,2", []int(nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := reflect.ValueOf(tt.ptr).Elem()
+			err := setFromString(v, tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setFromString(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got := v.Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setFromString(%q) = %#v, want %#v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvDefinedSliceIndex(t *testing.T) {
+	c := baseEnvConfig()
+	c.Server.Priority.Lanes = []LaneConf{{Priority: "high", Queue: "main"}, {Priority: "low", Queue: "main"}}
+	if err := c.ApplyEnv([]string{"MYRPC_SERVER_PRIORITY_LANES_1_QUEUE=other"}); err != nil {
+		t.Fatalf("ApplyEnv() error = %v", err)
+	}
+	want := []LaneConf{{Priority: "high", Queue: "main"}, {Priority: "low", Queue: "other"}}
+	if !reflect.DeepEqual(c.Server.Priority.Lanes, want) {
+		t.Errorf("lanes = %+v, want %+v", c.Server.Priority.Lanes, want)
+	}
+}
+
+func TestApplyEnvBadValues(t *testing.T) {
+	c := baseEnvConfig()
+	err := c.ApplyEnv([]string{
+		"MYRPC_SERVER_CONCURRENCY=many",
+		"MYRPC_PROVISION=yes please",
+		"MYRPC_CLIENT_REPLY_TIMEOUT=10",
+		"MYRPC_SERVER_PRIORITY_LANES_0_WEIGHT=1.5",
+		"MYRPC_QUEUES_MAIN_ATTRIBUTES_VISIBILITY_TIMEOUT=99999999999999999999",
+	})
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("ApplyEnv() error = %v, want ValidationErrors", err)
+	}
+
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"provision", "queues.main.attributes.visibility_timeout", "server.concurrency",
+		"server.priority.lanes.0.weight", "client.reply_timeout"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths of errors = %v, want %v", paths, want)
+	}
+}
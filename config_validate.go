@@ -0,0 +1,235 @@
+package myrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfFieldError is an invalid field of config
+type ConfFieldError struct {
+	// Path is the yaml path of field, such as queues.main.queue_name
+	Path string
+	Msg  string
+}
+
+func (e ConfFieldError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationErrors contains all invalid fields of config
+type ValidationErrors []ConfFieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+
+	return fmt.Sprintf("%d invalid fields: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+func (errs *ValidationErrors) add(path, format string, args ...interface{}) {
+	*errs = append(*errs, ConfFieldError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks all fields of config, and returns ValidationErrors with all invalid fields
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+
+	for _, name := range sortedKeys(c.Queues) {
+		path := joinPath("queues", name)
+		c.Queues[name].validate(path, &errs)
+		c.validateQueueRef(joinPath(path, "attributes.dead_letter_queue"), c.Queues[name].Attributes.DeadLetterQueue, &errs)
+	}
+
+	for _, name := range sortedKeys(c.Topics) {
+		c.Topics[name].validate(joinPath("topics", name), &errs)
+	}
+
+	if c.Server.Queue != "" {
+		c.Server.validate(c, &errs)
+	}
+	if c.Client.Queue != "" {
+		c.Client.validate(c, &errs)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateQueueRef checks that queue of given name is defined, if name is set
+func (c *Config) validateQueueRef(path, name string, errs *ValidationErrors) {
+	if name == "" {
+		return
+	}
+	if _, ok := c.Queues[name]; !ok {
+		errs.add(path, "undefined queue %q", name)
+	}
+}
+
+func (qc QueueConf) validate(path string, errs *ValidationErrors) {
+	if qc.Transport != "" && qc.Transport != TransportSQS {
+		errs.add(joinPath(path, "transport"), "unsupported transport %q", qc.Transport)
+	}
+	if qc.QueueName == "" {
+		errs.add(joinPath(path, "queue_name"), "is required")
+	}
+	if qc.QueueRegion == "" {
+		errs.add(joinPath(path, "queue_region"), "is required")
+	}
+
+	attrs, attrsPath := qc.Attributes, joinPath(path, "attributes")
+	if v := attrs.VisibilityTimeout; v < 0 || v > 43200 {
+		errs.add(joinPath(attrsPath, "visibility_timeout"), "must be between 0 and 43200, got %d", v)
+	}
+	if r := attrs.MessageRetentionPeriod; r != 0 && (r < 60 || r > 1209600) {
+		errs.add(joinPath(attrsPath, "message_retention_period"), "must be between 60 and 1209600, got %d", r)
+	}
+	if attrs.ContentBasedDeduplication && !qc.isFIFO() {
+		errs.add(joinPath(attrsPath, "content_based_deduplication"), "is supported on fifo queue only")
+	}
+	if attrs.DeadLetterQueue != "" && (attrs.MaxReceiveCount < 1 || attrs.MaxReceiveCount > 1000) {
+		errs.add(joinPath(attrsPath, "max_receive_count"), "must be between 1 and 1000, got %d", attrs.MaxReceiveCount)
+	}
+}
+
+func (tc TopicConf) validate(path string, errs *ValidationErrors) {
+	if !strings.HasPrefix(tc.TopicARN, "arn:") {
+		errs.add(joinPath(path, "topic_arn"), "must be an arn, got %q", tc.TopicARN)
+	}
+	if strings.HasSuffix(tc.TopicARN, fifoQueueSuffix) {
+		errs.add(joinPath(path, "topic_arn"), "fifo topic is not supported")
+	}
+	if tc.Region == "" {
+		errs.add(joinPath(path, "region"), "is required")
+	}
+}
+
+func (sc ServerConf) validate(c *Config, errs *ValidationErrors) {
+	c.validateQueueRef("server.queue", sc.Queue, errs)
+	c.validateQueueRef("server.dead_letter_queue", sc.DeadLetterQueue, errs)
+	for _, name := range sortedKeys(sc.Queues) {
+		path := joinPath("server.queues", name)
+		c.validateQueueRef(path, name, errs)
+		if sc.Queues[name].Weight < 0 {
+			errs.add(joinPath(path, "weight"), "must not be negative, got %d", sc.Queues[name].Weight)
+		}
+		if sc.Queues[name].Concurrency < 0 {
+			errs.add(joinPath(path, "concurrency"), "must not be negative, got %d", sc.Queues[name].Concurrency)
+		}
+	}
+	if n := sc.NumMsgsPerReceive; n < 1 || n > 10 {
+		errs.add("server.number_messages_per_receive", "must be between 1 and 10, got %d", n)
+	}
+	if sc.VisibilityTimeout < 0 {
+		errs.add("server.visibility_timeout", "must not be negative, got %d", sc.VisibilityTimeout)
+	}
+	if w := sc.WaitTimeSeconds; w < 0 || w > 20 {
+		errs.add("server.wait_time_seconds", "must be between 0 and 20, got %d", w)
+	}
+	if sc.Concurrency < 0 {
+		errs.add("server.concurrency", "must not be negative, got %d", sc.Concurrency)
+	}
+	sc.Priority.validate(c, errs)
+	if a := sc.ExpiredAction; a != "" && a != ExpiredDrop && a != ExpiredDeadLetter {
+		errs.add("server.expired_action", "must be %s or %s, got %q", ExpiredDrop, ExpiredDeadLetter, a)
+	}
+	if sc.Dedup.Size < 0 {
+		errs.add("server.dedup.size", "must not be negative, got %d", sc.Dedup.Size)
+	}
+	if sc.Dedup.Retention < 0 {
+		errs.add("server.dedup.retention", "must not be negative, got %s", sc.Dedup.Retention)
+	}
+	if sc.Retry.MaxAttempts < 0 {
+		errs.add("server.retry.max_attempts", "must not be negative, got %d", sc.Retry.MaxAttempts)
+	}
+	if sc.Admin.LivenessTimeout < 0 {
+		errs.add("server.admin.liveness_timeout", "must not be negative, got %s", sc.Admin.LivenessTimeout)
+	}
+	if sc.Admin.HandlerTimeout < 0 {
+		errs.add("server.admin.handler_timeout", "must not be negative, got %s", sc.Admin.HandlerTimeout)
+	}
+}
+
+func (cc ClientConf) validate(c *Config, errs *ValidationErrors) {
+	c.validateQueueRef("client.queue", cc.Queue, errs)
+	for _, route := range sortedKeys(cc.Routes) {
+		path := joinPath("client.routes", route)
+		if svr, _ := ParseRoute(route); svr == "" {
+			errs.add(path, "service is required")
+		}
+		if cc.Routes[route] == "" {
+			errs.add(path, "queue is required")
+		}
+		c.validateQueueRef(path, cc.Routes[route], errs)
+	}
+	for _, p := range sortedKeys(cc.Priorities) {
+		path := joinPath("client.priorities", p)
+		if cc.Priorities[p] == "" {
+			errs.add(path, "queue is required")
+		}
+		c.validateQueueRef(path, cc.Priorities[p], errs)
+	}
+	if name := cc.Compression; name != "" {
+		if _, ok := CompressorByName(name); !ok {
+			errs.add("client.compression", "unknown compression %q", name)
+		}
+	}
+	if cc.CompressionThreshold < 0 {
+		errs.add("client.compression_threshold", "must not be negative, got %d", cc.CompressionThreshold)
+	}
+	c.validateQueueRef("client.reply_queue", cc.ReplyQueue, errs)
+	if cc.ReplyTimeout < 0 {
+		errs.add("client.reply_timeout", "must not be negative, got %s", cc.ReplyTimeout)
+	}
+}
+
+// sortedKeys returns keys of given map with string keys in sorted order
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (pc PriorityConf) validate(c *Config, errs *ValidationErrors) {
+	if pc.Mode != "" && pc.Mode != PriorityStrict && pc.Mode != PriorityWeighted {
+		errs.add("server.priority.mode", "unknown mode %q", pc.Mode)
+	}
+	if pc.IdleWait < 0 {
+		errs.add("server.priority.idle_wait", "must not be negative, got %s", pc.IdleWait)
+	}
+	if pc.Weight < 0 {
+		errs.add("server.priority.weight", "must not be negative, got %d", pc.Weight)
+	}
+	if pc.Concurrency < 0 {
+		errs.add("server.priority.concurrency", "must not be negative, got %d", pc.Concurrency)
+	}
+
+	seen := make(map[Priority]bool, len(pc.Lanes))
+	for i, lane := range pc.Lanes {
+		path := fmt.Sprintf("server.priority.lanes.%d", i)
+		if lane.Priority == "" {
+			errs.add(joinPath(path, "priority"), "is required")
+		} else if seen[lane.Priority] {
+			errs.add(joinPath(path, "priority"), "duplicated priority %q", lane.Priority)
+		}
+		seen[lane.Priority] = true
+		if lane.Queue == "" {
+			errs.add(joinPath(path, "queue"), "is required")
+		}
+		c.validateQueueRef(joinPath(path, "queue"), lane.Queue, errs)
+		if lane.Weight < 0 {
+			errs.add(joinPath(path, "weight"), "must not be negative, got %d", lane.Weight)
+		}
+	}
+}
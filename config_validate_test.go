@@ -0,0 +1,170 @@
+package myrpc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func validConfig() Config {
+	return Config{
+		Queues: map[string]QueueConf{
+			"main": {QueueName: "main", QueueRegion: "us-east-1"},
+			"dlq":  {QueueName: "dlq", QueueRegion: "us-east-1"},
+		},
+		Topics: map[string]TopicConf{"events": {TopicARN: "arn:aws:sns:us-east-1:123456789012:events", Region: "us-east-1"}},
+		Server: ServerConf{Queue: "main", NumMsgsPerReceive: 10, DeadLetterQueue: "dlq",
+			Queues:   map[string]ServerQueueConf{"dlq": {Weight: 1}},
+			Priority: PriorityConf{Mode: PriorityStrict, Lanes: []LaneConf{{Priority: "high", Queue: "main"}}}},
+		Client: ClientConf{Queue: "main", Routes: map[string]string{"Echo/Hello": "dlq"},
+			Priorities: map[string]string{"high": "main"}, Compression: "gzip", ReplyQueue: "dlq"},
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	c := validConfig()
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	queue := func(c *Config, f func(q *QueueConf)) {
+		q := c.Queues["main"]
+		f(&q)
+		c.Queues["main"] = q
+	}
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		path    string
+		errPart string
+	}{
+		{"queue transport", func(c *Config) { queue(c, func(q *QueueConf) { q.Transport = "kafka" }) },
+			"queues.main.transport", `unsupported transport "kafka"`},
+		{"queue name", func(c *Config) { queue(c, func(q *QueueConf) { q.QueueName = "" }) },
+			"queues.main.queue_name", "is required"},
+		{"queue region", func(c *Config) { queue(c, func(q *QueueConf) { q.QueueRegion = "" }) },
+			"queues.main.queue_region", "is required"},
+		{"queue visibility timeout", func(c *Config) { queue(c, func(q *QueueConf) { q.Attributes.VisibilityTimeout = 43201 }) },
+			"queues.main.attributes.visibility_timeout", "between 0 and 43200"},
+		{"queue retention period", func(c *Config) { queue(c, func(q *QueueConf) { q.Attributes.MessageRetentionPeriod = 59 }) },
+			"queues.main.attributes.message_retention_period", "between 60 and 1209600"},
+		{"queue content based deduplication", func(c *Config) {
+			queue(c, func(q *QueueConf) { q.Attributes.ContentBasedDeduplication = true })
+		}, "queues.main.attributes.content_based_deduplication", "fifo queue only"},
+		{"queue max receive count", func(c *Config) { queue(c, func(q *QueueConf) { q.Attributes.DeadLetterQueue = "dlq" }) },
+			"queues.main.attributes.max_receive_count", "between 1 and 1000"},
+		{"queue dead letter queue", func(c *Config) {
+			queue(c, func(q *QueueConf) { q.Attributes.DeadLetterQueue, q.Attributes.MaxReceiveCount = "none", 5 })
+		}, "queues.main.attributes.dead_letter_queue", `undefined queue "none"`},
+		{"topic arn", func(c *Config) { c.Topics["events"] = TopicConf{TopicARN: "events", Region: "us-east-1"} },
+			"topics.events.topic_arn", "must be an arn"},
+		{"fifo topic", func(c *Config) {
+			c.Topics["events"] = TopicConf{TopicARN: "arn:aws:sns:us-east-1:123456789012:events.fifo", Region: "us-east-1"}
+		}, "topics.events.topic_arn", "fifo topic is not supported"},
+		{"topic region", func(c *Config) { c.Topics["events"] = TopicConf{TopicARN: "arn:aws:sns:us-east-1:1:events"} },
+			"topics.events.region", "is required"},
+		{"server queue", func(c *Config) { c.Server.Queue = "none" }, "server.queue", `undefined queue "none"`},
+		{"server dead letter queue", func(c *Config) { c.Server.DeadLetterQueue = "none" },
+			"server.dead_letter_queue", `undefined queue "none"`},
+		{"server queues undefined", func(c *Config) { c.Server.Queues["none"] = ServerQueueConf{} },
+			"server.queues.none", `undefined queue "none"`},
+		{"server queues weight", func(c *Config) { c.Server.Queues["dlq"] = ServerQueueConf{Weight: -1} },
+			"server.queues.dlq.weight", "must not be negative"},
+		{"server queues concurrency", func(c *Config) { c.Server.Queues["dlq"] = ServerQueueConf{Concurrency: -1} },
+			"server.queues.dlq.concurrency", "must not be negative"},
+		{"server number messages per receive", func(c *Config) { c.Server.NumMsgsPerReceive = 11 },
+			"server.number_messages_per_receive", "between 1 and 10"},
+		{"server visibility timeout", func(c *Config) { c.Server.VisibilityTimeout = -1 },
+			"server.visibility_timeout", "must not be negative"},
+		{"server wait time seconds", func(c *Config) { c.Server.WaitTimeSeconds = 21 },
+			"server.wait_time_seconds", "between 0 and 20"},
+		{"server concurrency", func(c *Config) { c.Server.Concurrency = -1 }, "server.concurrency", "must not be negative"},
+		{"server expired action", func(c *Config) { c.Server.ExpiredAction = "keep" },
+			"server.expired_action", `got "keep"`},
+		{"server dedup size", func(c *Config) { c.Server.Dedup.Size = -1 }, "server.dedup.size", "must not be negative"},
+		{"server dedup retention", func(c *Config) { c.Server.Dedup.Retention = -1 },
+			"server.dedup.retention", "must not be negative"},
+		{"server retry max attempts", func(c *Config) { c.Server.Retry.MaxAttempts = -1 },
+			"server.retry.max_attempts", "must not be negative"},
+		{"server admin liveness timeout", func(c *Config) { c.Server.Admin.LivenessTimeout = -1 },
+			"server.admin.liveness_timeout", "must not be negative"},
+		{"server admin handler timeout", func(c *Config) { c.Server.Admin.HandlerTimeout = -1 },
+			"server.admin.handler_timeout", "must not be negative"},
+		{"priority mode", func(c *Config) { c.Server.Priority.Mode = "random" },
+			"server.priority.mode", `unknown mode "random"`},
+		{"priority idle wait", func(c *Config) { c.Server.Priority.IdleWait = -1 },
+			"server.priority.idle_wait", "must not be negative"},
+		{"priority weight", func(c *Config) { c.Server.Priority.Weight = -1 },
+			"server.priority.weight", "must not be negative"},
+		{"priority concurrency", func(c *Config) { c.Server.Priority.Concurrency = -1 },
+			"server.priority.concurrency", "must not be negative"},
+		{"lane priority", func(c *Config) { c.Server.Priority.Lanes[0].Priority = "" },
+			"server.priority.lanes.0.priority", "is required"},
+		{"lane duplicated priority", func(c *Config) {
+			c.Server.Priority.Lanes = append(c.Server.Priority.Lanes, LaneConf{Priority: "high", Queue: "dlq"})
+		}, "server.priority.lanes.1.priority", `duplicated priority "high"`},
+		{"lane queue", func(c *Config) { c.Server.Priority.Lanes[0].Queue = "" },
+			"server.priority.lanes.0.queue", "is required"},
+		{"lane undefined queue", func(c *Config) { c.Server.Priority.Lanes[0].Queue = "none" },
+			"server.priority.lanes.0.queue", `undefined queue "none"`},
+		{"lane weight", func(c *Config) { c.Server.Priority.Lanes[0].Weight = -1 },
+			"server.priority.lanes.0.weight", "must not be negative"},
+		{"client queue", func(c *Config) { c.Client.Queue = "none" }, "client.queue", `undefined queue "none"`},
+		{"route service", func(c *Config) { c.Client.Routes = map[string]string{"/Hello": "dlq"} },
+			"client.routes./Hello", "service is required"},
+		{"route queue", func(c *Config) { c.Client.Routes["Echo/Hello"] = "" },
+			"client.routes.Echo/Hello", "queue is required"},
+		{"route undefined queue", func(c *Config) { c.Client.Routes["Echo/Hello"] = "none" },
+			"client.routes.Echo/Hello", `undefined queue "none"`},
+		{"priority queue", func(c *Config) { c.Client.Priorities["high"] = "" },
+			"client.priorities.high", "queue is required"},
+		{"priority undefined queue", func(c *Config) { c.Client.Priorities["high"] = "none" },
+			"client.priorities.high", `undefined queue "none"`},
+		{"client compression", func(c *Config) { c.Client.Compression = "brotli" },
+			"client.compression", `unknown compression "brotli"`},
+		{"client compression threshold", func(c *Config) { c.Client.CompressionThreshold = -1 },
+			"client.compression_threshold", "must not be negative"},
+		{"client reply queue", func(c *Config) { c.Client.ReplyQueue = "none" },
+			"client.reply_queue", `undefined queue "none"`},
+		{"client reply timeout", func(c *Config) { c.Client.ReplyTimeout = -1 },
+			"client.reply_timeout", "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.mutate(&c)
+			errs, ok := c.Validate().(ValidationErrors)
+			if !ok || len(errs) != 1 {
+				t.Fatalf("Validate() error = %v, want one error", c.Validate())
+			}
+			if errs[0].Path != tt.path || !strings.Contains(errs[0].Msg, tt.errPart) {
+				t.Errorf("Validate() error = %v, want %s: ...%s...", errs[0], tt.path, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	c := validConfig()
+	c.Queues["main"] = QueueConf{QueueName: "main"}
+	c.Server.Concurrency = -1
+	c.Client.Compression = "brotli"
+
+	errs, ok := c.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Validate() error = %v, want ValidationErrors", c.Validate())
+	}
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"queues.main.queue_region", "server.concurrency", "client.compression"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths of errors = %v, want %v", paths, want)
+	}
+	if !strings.HasPrefix(errs.Error(), "3 invalid fields: queues.main.queue_region: is required; ") {
+		t.Errorf("Error() = %q", errs.Error())
+	}
+}
@@ -0,0 +1,191 @@
+package myrpc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// dataKeySize is the size of per-message data key, in bytes (AES-256)
+const dataKeySize = 32
+
+// KeyProvider is the interface to manage data keys of payload encryption (envelope encryption).
+// Each message is encrypted by its own data key, which is wrapped by a master key of the provider.
+type KeyProvider interface {
+	// GenerateDataKey returns new data key in plaintext, and the same key wrapped by current master key
+	GenerateDataKey() (keyID string, plaintext []byte, wrapped []byte, err error)
+	// DecryptDataKey unwraps data key that was wrapped by master key of given id
+	DecryptDataKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// EncryptionInfo contains info to decrypt payload of a message
+type EncryptionInfo struct {
+	// KeyID is id of master key that wraps the data key
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// encryptPayload encrypts payload of message by AES-GCM with new data key from given provider
+func encryptPayload(msg *RPCMessage, kp KeyProvider) error {
+	keyID, dataKey, wrappedKey, err := kp.GenerateDataKey()
+	if err != nil {
+		return errors.Wrap(err, "cannot generate data key")
+	}
+
+	nonce, ciphertext, err := sealAESGCM(dataKey, msg.Payload, payloadAAD(msg))
+	if err != nil {
+		return errors.Wrapf(err, "cannot encrypt payload of %s/%s", msg.SvrName, msg.MthName)
+	}
+
+	msg.Payload = ciphertext
+	msg.Encryption = &EncryptionInfo{
+		KeyID:      keyID,
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+	}
+
+	return nil
+}
+
+// decryptPayload decrypts given payload of message by key from given provider
+func decryptPayload(msg *RPCMessage, payload []byte, kp KeyProvider) ([]byte, error) {
+	if msg.Encryption == nil {
+		return payload, nil
+	}
+	if kp == nil {
+		return nil, fmt.Errorf("no key provider for encrypted payload of %s/%s", msg.SvrName, msg.MthName)
+	}
+
+	dataKey, err := kp.DecryptDataKey(msg.Encryption.KeyID, msg.Encryption.WrappedKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decrypt data key by key %s", msg.Encryption.KeyID)
+	}
+
+	plaintext, err := openAESGCM(dataKey, msg.Encryption.Nonce, payload, payloadAAD(msg))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decrypt payload of %s/%s", msg.SvrName, msg.MthName)
+	}
+
+	return plaintext, nil
+}
+
+// payloadAAD binds encrypted payload to its service and method,
+// so payload cannot be replayed to other method
+func payloadAAD(msg *RPCMessage) []byte {
+	return []byte(string(msg.SvrName) + "\x00" + string(msg.MthName))
+}
+
+func sealAESGCM(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate nonce")
+	}
+
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func openAESGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.Errorf("invalid nonce size: %d", len(nonce))
+	}
+
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid aes key")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// FileKeyProviderConf contains master keys of file key provider
+type FileKeyProviderConf struct {
+	// CurrentKeyID is id of master key that wraps new data keys
+	CurrentKeyID string `yaml:"current_key_id"`
+	// Keys are master keys in base64 format, by their id.
+	// Old keys should be kept until all messages encrypted by them are handled.
+	Keys map[string]string `yaml:"keys"`
+}
+
+type fileKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewFileKeyProvider returns a key provider with master keys loaded from given yaml file.
+// It is intended for tests and local environment, use KMS key provider on production.
+func NewFileKeyProvider(filePath string) (KeyProvider, error) {
+	var conf FileKeyProviderConf
+	if err := yamlFileToStruct(filePath, "key provider", &conf); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(conf.Keys))
+	for keyID, encoded := range conf.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s in key file: %s", keyID, filePath)
+		}
+		if len(key) != dataKeySize {
+			return nil, errors.Errorf("key %s in key file %s must be %d bytes", keyID, filePath, dataKeySize)
+		}
+		keys[keyID] = key
+	}
+	if _, ok := keys[conf.CurrentKeyID]; !ok {
+		return nil, errors.Errorf("no current key %s in key file: %s", conf.CurrentKeyID, filePath)
+	}
+
+	return &fileKeyProvider{
+		currentKeyID: conf.CurrentKeyID,
+		keys:         keys,
+	}, nil
+}
+
+func (kp *fileKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", nil, nil, errors.Wrap(err, "cannot generate data key")
+	}
+
+	nonce, wrapped, err := sealAESGCM(kp.keys[kp.currentKeyID], dataKey, []byte(kp.currentKeyID))
+	if err != nil {
+		return "", nil, nil, errors.Wrapf(err, "cannot wrap data key by key %s", kp.currentKeyID)
+	}
+
+	return kp.currentKeyID, dataKey, append(nonce, wrapped...), nil
+}
+
+func (kp *fileKeyProvider) DecryptDataKey(keyID string, wrapped []byte) ([]byte, error) {
+	masterKey, ok := kp.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("unknown key: %s", keyID)
+	}
+
+	aead, err := newAESGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("invalid wrapped key")
+	}
+
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
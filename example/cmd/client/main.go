@@ -14,20 +14,19 @@ import (
 )
 
 func main() {
-	conf, err := myrpc.SenderConfFromYamlFile("../../config/sender.yaml")
+	conf, err := myrpc.ConfigFromYamlFile("../../config/myrpc.yaml")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on read sender conf file: %+v", err)
+		fmt.Fprintf(os.Stderr, "error on read conf file: %+v", err)
 		return
 	}
 
 	ctx := context.Background()
-	sqsSender, err := myrpc.NewSQSSender(ctx, *conf)
+	client, err := myrpc.NewRPCClientFromConf(ctx, conf)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on init sqs: %+v", err)
+		fmt.Fprintf(os.Stderr, "error on init client: %+v", err)
 		return
 	}
 
-	client := myrpc.NewRPCClient(ctx, sqsSender)
 	var wg sync.WaitGroup
 
 	// send message in json format
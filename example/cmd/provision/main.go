@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/manhdaovan/myrpc"
+)
+
+// creates queues of config and corrects their attributes,
+// or prints planned changes only with -dry-run
+func main() {
+	confFile := flag.String("conf", "../../config/myrpc.yaml", "config file")
+	dryRun := flag.Bool("dry-run", false, "print planned changes without applying them")
+	flag.Parse()
+
+	conf, err := myrpc.ConfigFromYamlFile(*confFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on read conf file: %+v", err)
+		os.Exit(1)
+	}
+
+	provisioner, err := myrpc.NewSQSProvisioner(context.Background(), conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on init provisioner: %+v", err)
+		os.Exit(1)
+	}
+
+	var plan *myrpc.ProvisionPlan
+	if *dryRun {
+		plan, err = provisioner.Plan()
+	} else {
+		plan, err = provisioner.Apply()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on provision queues: %+v", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(plan)
+}
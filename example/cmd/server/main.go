@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/manhdaovan/myrpc"
@@ -12,31 +13,24 @@ import (
 func main() {
 	ctx := context.Background()
 
-	rconf, err := myrpc.ReceiverConfFromYamlFile("../../config/receiver.yaml")
+	conf, err := myrpc.ConfigFromYamlFile("../../config/myrpc.yaml")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on read receiver conf file: %+v", err)
-		return
-	}
-	sqsReceiver, err := myrpc.NewSQSReceiver(ctx, *rconf)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on init sqsReceiver: %+v", err)
+		fmt.Fprintf(os.Stderr, "error on read conf file: %+v", err)
 		return
 	}
 
-	dconf, err := myrpc.DeleterConfFromYamlFile("../../config/deleter.yaml")
+	// init server
+	svr, err := myrpc.NewRPCServerFromConf(ctx, conf)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on read deleter conf file: %+v", err)
+		fmt.Fprintf(os.Stderr, "error on init server: %+v", err)
 		return
 	}
-	sqsDeleter, err := myrpc.NewSQSDeleter(ctx, *dconf)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error on init sqsDeleter: %+v", err)
+	svr.SetLogger(myrpc.NewSlogLogger(slog.New(slog.NewTextHandler(os.Stdout, nil))))
+	if err := svr.StartAdmin(conf.Server.Admin); err != nil {
+		fmt.Fprintf(os.Stderr, "error on start admin server: %+v", err)
 		return
 	}
 
-	// init server
-	svr := myrpc.NewRPCServer(ctx, sqsReceiver, sqsDeleter)
-
 	// register all services to server
 	service.RegisterFreeService(svr, &service.FreeService{})
 	service.RegisterProtoService(svr, &service.ProtoService{})
@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/manhdaovan/myrpc"
+	"github.com/manhdaovan/myrpc/example/message"
+	"github.com/manhdaovan/myrpc/example/service"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+)
+
+// benchPayload is a payload of example message types
+type benchPayload struct {
+	name    string
+	svr     myrpc.ServiceName
+	mth     myrpc.MethodName
+	payload []byte
+}
+
+var compressions = []string{myrpc.CompressionGzip, myrpc.CompressionZstd, myrpc.CompressionSnappy}
+
+// benchPayloads returns encoded FreeMessageIn and EchoProtoIn of repetitive events, typical for messages
+func benchPayloads(b *testing.B) []benchPayload {
+	text := strings.Repeat(`{"user_id": 12345, "event": "page_view", "path": "/items/67890"} `, 200)
+	freePayload, err := json.Marshal(&message.FreeMessageIn{Msg: text})
+	if err != nil {
+		b.Fatal(err)
+	}
+	protoPayload, err := encoding.GetCodec(proto.Name).Marshal(&message.EchoProtoIn{Msg: text})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return []benchPayload{
+		{name: "FreeMessageIn", svr: service.FreeServiceName, mth: service.FreeServiceEchoMethodName, payload: freePayload},
+		{name: "EchoProtoIn", svr: service.ProtoServiceName, mth: service.ProtoServiceEchoMethodName, payload: protoPayload},
+	}
+}
+
+// sqsSize returns size of message body that is sent to SQS
+func sqsSize(b *testing.B, msg *myrpc.RPCMessage) int {
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return len(msgJSON)
+}
+
+// BenchmarkCompress reports CPU cost of compression, and size of SQS message of example payloads
+func BenchmarkCompress(b *testing.B) {
+	for _, p := range benchPayloads(b) {
+		rawSize := sqsSize(b, &myrpc.RPCMessage{SvrName: p.svr, MthName: p.mth, Payload: p.payload})
+		for _, algo := range compressions {
+			c, _ := myrpc.CompressorByName(algo)
+			b.Run(p.name+"/"+algo, func(b *testing.B) {
+				compressed, err := c.Compress(p.payload)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size := sqsSize(b, &myrpc.RPCMessage{SvrName: p.svr, MthName: p.mth, Payload: compressed, Compression: algo})
+
+				b.SetBytes(int64(len(p.payload)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Compress(p.payload); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(rawSize), "raw-sqs-bytes")
+				b.ReportMetric(float64(size), "sqs-bytes")
+				b.ReportMetric(float64(rawSize)/float64(size), "ratio")
+			})
+		}
+	}
+}
+
+// BenchmarkDecompress reports CPU cost of decompression of example payloads
+func BenchmarkDecompress(b *testing.B) {
+	for _, p := range benchPayloads(b) {
+		for _, algo := range compressions {
+			c, _ := myrpc.CompressorByName(algo)
+			b.Run(p.name+"/"+algo, func(b *testing.B) {
+				compressed, err := c.Compress(p.payload)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.SetBytes(int64(len(p.payload)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Decompress(compressed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
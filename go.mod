@@ -1,12 +1,14 @@
 module github.com/manhdaovan/myrpc
 
-go 1.12
+go 1.13
 
 require (
-	github.com/aws/aws-sdk-go v1.20.6
-	github.com/pkg/errors v0.8.0
-	github.com/stretchr/testify v1.3.0 // indirect
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
+	github.com/aws/aws-sdk-go v1.34.0
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/snappy v0.0.1
+	github.com/klauspost/compress v1.9.8
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/pkg/errors v0.9.1
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	gopkg.in/yaml.v2 v2.2.2
 )
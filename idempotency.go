@@ -0,0 +1,131 @@
+package myrpc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Defaults of dedup stores
+const (
+	DefaultDedupRetention = 24 * time.Hour
+	DefaultDedupSize      = 10000
+)
+
+// DedupConf contains info about in-memory dedup store of server, see NewMemoryDedupStore
+type DedupConf struct {
+	Enabled   bool          `yaml:"enabled"`
+	Size      int           `yaml:"size"`
+	Retention time.Duration `yaml:"retention"`
+}
+
+// DedupRecord is the record of handled message in dedup store
+type DedupRecord struct {
+	// Reply is the encoded result of handler, in case message is a request
+	Reply []byte
+	// HandledAt is the time message was handled
+	HandledAt time.Time
+}
+
+// DedupStore is the interface to record handled messages by their ID, see RPCServer.UseDedupStore
+type DedupStore interface {
+	// Get returns record of handled message of given id, or false if message is not handled yet
+	Get(id string) (DedupRecord, bool, error)
+	// Put records handled message of given id
+	Put(id string, rec DedupRecord) error
+}
+
+// idempotencyID derives message id from given idempotency key of given method,
+// so retries of the same operation are sent as the same message
+func idempotencyID(svr ServiceName, mth MethodName, key string) string {
+	sum := sha256.Sum256([]byte(string(svr) + "/" + string(mth) + "/" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+type dedupEntry struct {
+	id  string
+	rec DedupRecord
+}
+
+// MemoryDedupStore is an in-memory DedupStore that keeps most recently used records of handled messages,
+// for a single server process
+type MemoryDedupStore struct {
+	locker    sync.Mutex
+	size      int
+	retention time.Duration
+	// entries from most to least recently put or got
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+// NewMemoryDedupStore returns store that keeps at most size records, each for given retention.
+// Non positive size or retention means DefaultDedupSize or DefaultDedupRetention.
+func NewMemoryDedupStore(size int, retention time.Duration) *MemoryDedupStore {
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+	if retention <= 0 {
+		retention = DefaultDedupRetention
+	}
+
+	return &MemoryDedupStore{
+		size:      size,
+		retention: retention,
+		entries:   list.New(),
+		index:     make(map[string]*list.Element),
+	}
+}
+
+// Get returns record of handled message of given id, if it is not evicted nor expired.
+// Found record becomes the most recently used one.
+func (s *MemoryDedupStore) Get(id string) (DedupRecord, bool, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	e, ok := s.index[id]
+	if !ok {
+		return DedupRecord{}, false, nil
+	}
+	entry := e.Value.(*dedupEntry)
+	if time.Since(entry.rec.HandledAt) > s.retention {
+		s.remove(e)
+		return DedupRecord{}, false, nil
+	}
+	s.entries.MoveToFront(e)
+
+	return entry.rec, true, nil
+}
+
+// Put records handled message of given id, evicting the least recently used one if store is full
+func (s *MemoryDedupStore) Put(id string, rec DedupRecord) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if e, ok := s.index[id]; ok {
+		e.Value.(*dedupEntry).rec = rec
+		s.entries.MoveToFront(e)
+		return nil
+	}
+
+	s.index[id] = s.entries.PushFront(&dedupEntry{id: id, rec: rec})
+	for s.entries.Len() > s.size {
+		s.remove(s.entries.Back())
+	}
+
+	return nil
+}
+
+// Len returns number of records in store, including expired ones not yet evicted
+func (s *MemoryDedupStore) Len() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.entries.Len()
+}
+
+func (s *MemoryDedupStore) remove(e *list.Element) {
+	s.entries.Remove(e)
+	delete(s.index, e.Value.(*dedupEntry).id)
+}
@@ -0,0 +1,123 @@
+package myrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStoreEviction(t *testing.T) {
+	s := NewMemoryDedupStore(2, time.Hour)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Put(id, DedupRecord{HandledAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok, _ := s.Get("a"); ok {
+		t.Error("least recently used record is not evicted")
+	}
+	for _, id := range []string{"b", "c"} {
+		if _, ok, _ := s.Get(id); !ok {
+			t.Errorf("record %s is evicted", id)
+		}
+	}
+	if s.Len() != 2 {
+		t.Errorf("store has %d records, want 2", s.Len())
+	}
+}
+
+func TestMemoryDedupStoreEvictionOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []string
+		evicted []string
+		kept    []string
+	}{
+		{"put order", []string{"put a", "put b", "put c", "put d"}, []string{"a"}, []string{"b", "c", "d"}},
+		{"got record is kept", []string{"put a", "put b", "put c", "get a", "put d"}, []string{"b"}, []string{"a", "c", "d"}},
+		{"put again is kept", []string{"put a", "put b", "put c", "put a", "put d"}, []string{"b"}, []string{"a", "c", "d"}},
+		{"missing get changes nothing", []string{"put a", "put b", "put c", "get x", "put d"}, []string{"a"}, []string{"b", "c", "d"}},
+		{"several gets", []string{"put a", "put b", "put c", "get b", "get a", "put d", "put e"},
+			[]string{"c", "b"}, []string{"a", "d", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryDedupStore(3, time.Hour)
+			for _, op := range tt.ops {
+				id := op[len(op)-1:]
+				if op[:3] == "put" {
+					if err := s.Put(id, DedupRecord{HandledAt: time.Now()}); err != nil {
+						t.Fatal(err)
+					}
+				} else if _, _, err := s.Get(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// check evicted ones first, since Get of kept ones changes order
+			for _, id := range tt.evicted {
+				if _, ok, _ := s.Get(id); ok {
+					t.Errorf("record %s is not evicted", id)
+				}
+			}
+			for _, id := range tt.kept {
+				if _, ok, _ := s.Get(id); !ok {
+					t.Errorf("record %s is evicted", id)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryDedupStoreRetention(t *testing.T) {
+	s := NewMemoryDedupStore(0, time.Minute)
+	if err := s.Put("old", DedupRecord{HandledAt: time.Now().Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("new", DedupRecord{Reply: []byte("reply"), HandledAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := s.Get("old"); ok {
+		t.Error("expired record is returned")
+	}
+	if rec, ok, _ := s.Get("new"); !ok || string(rec.Reply) != "reply" {
+		t.Errorf("record is %+v %t, want reply", rec, ok)
+	}
+	if s.Len() != 1 {
+		t.Errorf("expired record is not removed, store has %d records", s.Len())
+	}
+}
+
+// testSyncReplay sends the same synchronous call three times by an idempotency key,
+// and checks it is handled once while each call gets the cached reply
+func testSyncReplay(t *testing.T, store DedupStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, rq := NewMemoryQueue(), NewMemoryQueue()
+	srv := NewRPCServer(ctx, q, q)
+	srv.SetReplySender(ReplyQueues{"replies": rq})
+	srv.UseDedupStore(store)
+	calls := serveDouble(srv)
+
+	c := NewRPCClient(ctx, q)
+	c.UseReplyQueue("replies", rq, rq)
+	for i := 0; i < 3; i++ {
+		var out int
+		if err := c.SendSyncMsg("svc", "double", &echoIn{N: 21}, &out, nil, WithIdempotencyKey("op-1")); err != nil {
+			t.Fatal(err)
+		}
+		if out != 42 {
+			t.Errorf("reply of call %d is %d, want 42", i, out)
+		}
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("handler is called %d times, want 1", n)
+	}
+}
+
+func TestSyncReplayMemoryDedupStore(t *testing.T) {
+	testSyncReplay(t, NewMemoryDedupStore(0, 0))
+}
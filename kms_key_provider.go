@@ -0,0 +1,50 @@
+package myrpc
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/pkg/errors"
+)
+
+type kmsKeyProvider struct {
+	ctx   context.Context
+	kms   kmsiface.KMSAPI
+	keyID string
+}
+
+// NewKMSKeyProvider returns a key provider that generates and decrypts data keys by AWS KMS.
+// keyID is id, ARN or alias of the KMS master key that wraps new data keys.
+// Rotating the master key on KMS keeps old messages decryptable.
+func NewKMSKeyProvider(ctx context.Context, client kmsiface.KMSAPI, keyID string) KeyProvider {
+	return &kmsKeyProvider{
+		ctx:   ctx,
+		kms:   client,
+		keyID: keyID,
+	}
+}
+
+func (kp *kmsKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	param := &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(kp.keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	}
+	resp, err := kp.kms.GenerateDataKeyWithContext(kp.ctx, param)
+	if err != nil {
+		return "", nil, nil, errors.Wrapf(err, "cannot generate data key by kms key %s", kp.keyID)
+	}
+
+	return aws.StringValue(resp.KeyId), resp.Plaintext, resp.CiphertextBlob, nil
+}
+
+func (kp *kmsKeyProvider) DecryptDataKey(keyID string, wrapped []byte) ([]byte, error) {
+	// wrapped key of KMS contains id of master key itself
+	resp, err := kp.kms.DecryptWithContext(kp.ctx, &kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decrypt data key by kms key %s", keyID)
+	}
+
+	return resp.Plaintext, nil
+}
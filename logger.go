@@ -0,0 +1,60 @@
+package myrpc
+
+import "time"
+
+// Keys of structured log fields
+const (
+	FieldService   = "service"
+	FieldMethod    = "method"
+	FieldMessageID = "message_id"
+	FieldAttempt   = "attempt"
+	FieldLatency   = "latency"
+	FieldError     = "error"
+	// FieldCorrelationID is the id of request of a reply
+	FieldCorrelationID = "correlation_id"
+	FieldReplyTo       = "reply_to"
+)
+
+// Field is a key/value pair of structured log
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the interface of structured, leveled logger that is used by RPCServer and RPCClient
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+type nopLogger struct{}
+
+// NopLogger returns a logger that discards all logs. It is the default logger.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+
+// msgFields returns log fields that identify given message
+func msgFields(msg *RPCMessage, fields ...Field) []Field {
+	return append([]Field{
+		{Key: FieldService, Value: msg.SvrName},
+		{Key: FieldMethod, Value: msg.MthName},
+		{Key: FieldMessageID, Value: msg.ID},
+		{Key: FieldAttempt, Value: msg.attempt},
+	}, fields...)
+}
+
+func latencyField(start time.Time) Field {
+	return Field{Key: FieldLatency, Value: time.Since(start)}
+}
+
+func errField(err error) Field {
+	return Field{Key: FieldError, Value: err}
+}
@@ -1,14 +1,107 @@
 package myrpc
 
-import "encoding/json"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
 
 // RPCMessage represents message of this RPC
 type RPCMessage struct {
+	// ID is the unique id of message, generated by client
+	ID      string      `json:"id,omitempty"`
 	SvrName ServiceName `json:"service_name"`
 	MthName MethodName  `json:"method_name"`
 	Payload []byte      `json:"payload"`
+	// PayloadRef is the key of payload in blob store, in case payload is offloaded
+	PayloadRef string `json:"payload_ref,omitempty"`
+	// PayloadDigest is the SHA-256 digest of offloaded payload, so its blob could not be replaced
+	PayloadDigest []byte `json:"payload_digest,omitempty"`
+	// Compression is the name of algorithm that payload is compressed by
+	Compression string `json:"compression,omitempty"`
+	// Encryption contains info to decrypt payload, in case payload is encrypted
+	Encryption *EncryptionInfo `json:"encryption,omitempty"`
+	// Metadata contains additional info of message, such as identity of sender
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Timestamp is the time in unix nano when message was created
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Signature is the signature of all other fields of message
+	Signature *Signature `json:"signature,omitempty"`
+	// GroupID is the message group on FIFO queue.
+	// Messages in the same group are processed one at a time, in order.
+	GroupID string `json:"group_id,omitempty"`
+	// DedupID is the deduplication id on FIFO queue
+	DedupID string `json:"dedup_id,omitempty"`
+	// DeliverAt is the time in unix nano when message should be handled
+	DeliverAt int64 `json:"deliver_at,omitempty"`
+	// Priority is the lane that message is sent to, see PrioritySender
+	Priority Priority `json:"priority,omitempty"`
+	// Topic is the topic that message is published to, see RPCClient.Publish.
+	// SvrName of published message is its topic.
+	Topic string `json:"topic,omitempty"`
+	// ReplyTo is the address of queue that reply of request is sent to, see RPCClient.UseReplyQueue
+	ReplyTo string `json:"reply_to,omitempty"`
+	// CorrelationID of reply is ID of its request
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// ReplyError is the error of handler, in case reply is a failure
+	ReplyError string `json:"reply_error,omitempty"`
+	// Deadline is the time in unix nano after which message is worthless, such as deadline of caller.
+	// Handler context has this deadline, and message expired in queue is not handled.
+	Deadline int64 `json:"deadline,omitempty"`
 	// use for delete message
 	msgReceiptHandle string
+	// number of times message has been received, set by receiver if supported
+	attempt int
+	// time message was sent to message service, set by receiver if supported
+	sentAt time.Time
+	// time server started receiving message
+	receivedAt time.Time
+	// priority lane that message is received from, set by PriorityReceiver
+	lane Priority
+}
+
+// Attempt returns number of times message has been received,
+// or 0 if receiver does not support it
+func (msg *RPCMessage) Attempt() int {
+	return msg.attempt
+}
+
+// remainingDelay returns duration until message should be handled
+func (msg *RPCMessage) remainingDelay() time.Duration {
+	if msg.DeliverAt == 0 {
+		return 0
+	}
+
+	return time.Until(time.Unix(0, msg.DeliverAt))
+}
+
+// expiresAt returns time in unix nano when message expires, by its deadline,
+// or by given default TTL of its method from its delivery time. It is 0 if message never expires.
+func (msg *RPCMessage) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 || msg.Timestamp == 0 {
+		return msg.Deadline
+	}
+
+	return earliest(msg.Deadline, msgStart(msg)+int64(ttl))
+}
+
+// msgStart returns delivery time of message in unix nano, or its timestamp if it is not delayed
+func msgStart(msg *RPCMessage) int64 {
+	if msg.DeliverAt > msg.Timestamp {
+		return msg.DeliverAt
+	}
+
+	return msg.Timestamp
+}
+
+// earliest returns the earliest of given times in unix nano, ignoring 0
+func earliest(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+
+	return a
 }
 
 // ToJSON converts RPCMessage to json in string format
@@ -26,3 +119,13 @@ func JSONToRPCMsg(jsonStr string) (*RPCMessage, error) {
 
 	return &msg, nil
 }
+
+// newID returns a random id in hex format
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+
+	return hex.EncodeToString(b)
+}
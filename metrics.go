@@ -0,0 +1,57 @@
+package myrpc
+
+import "time"
+
+// Metrics is the interface to record metrics of RPCServer and RPCClient.
+// Implementations should embed NopMetrics, so they keep compiling when new metrics are added.
+type Metrics interface {
+	// BatchReceived is called on each receive from message service, with number of received messages
+	BatchReceived(size int)
+	// MsgReceived is called when server starts handling a message.
+	// dwell is the time message waited in the queue, or 0 if unknown.
+	MsgReceived(svr ServiceName, mth MethodName, dwell time.Duration)
+	// MsgHandled is called when server finishes handling a message, err is nil on success
+	MsgHandled(svr ServiceName, mth MethodName, latency time.Duration, err error)
+	// MsgDeleted is called when a message is deleted from the queue
+	MsgDeleted(svr ServiceName, mth MethodName)
+	// MsgDeadLettered is called when a message is sent to dead letter queue
+	MsgDeadLettered(svr ServiceName, mth MethodName)
+	// MsgExpired is called when a message expired before it is handled, see RPCMessage.Deadline
+	MsgExpired(svr ServiceName, mth MethodName)
+	// InFlight is called with 1 when a handler starts, and with -1 when it finishes
+	InFlight(delta int)
+	// MsgSent is called when client finishes sending a message, err is nil on success
+	MsgSent(svr ServiceName, mth MethodName, latency time.Duration, err error)
+	// LanePolled is called when PriorityReceiver polls a lane, with number of received messages
+	LanePolled(lane Priority, size int)
+	// LaneHandled is called when server finishes handling a message received from a priority lane
+	LaneHandled(lane Priority, dwell, latency time.Duration, err error)
+}
+
+// NopMetrics discards all metrics. It is the default metrics.
+type NopMetrics struct{}
+
+func (NopMetrics) BatchReceived(int)                                         {}
+func (NopMetrics) MsgReceived(ServiceName, MethodName, time.Duration)        {}
+func (NopMetrics) MsgHandled(ServiceName, MethodName, time.Duration, error)  {}
+func (NopMetrics) MsgDeleted(ServiceName, MethodName)                        {}
+func (NopMetrics) MsgDeadLettered(ServiceName, MethodName)                   {}
+func (NopMetrics) MsgExpired(ServiceName, MethodName)                        {}
+func (NopMetrics) InFlight(int)                                              {}
+func (NopMetrics) MsgSent(ServiceName, MethodName, time.Duration, error)     {}
+func (NopMetrics) LanePolled(Priority, int)                                  {}
+func (NopMetrics) LaneHandled(Priority, time.Duration, time.Duration, error) {}
+
+// dwellTime returns time that message waited in the queue,
+// based on sent time from message service, or timestamp of message otherwise
+func dwellTime(msg *RPCMessage) time.Duration {
+	sentAt := msg.sentAt
+	if sentAt.IsZero() && msg.Timestamp != 0 {
+		sentAt = time.Unix(0, msg.Timestamp)
+	}
+	if sentAt.IsZero() {
+		return 0
+	}
+
+	return time.Since(sentAt)
+}
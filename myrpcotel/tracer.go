@@ -0,0 +1,136 @@
+// Package myrpcotel propagates OpenTelemetry traces across myrpc queues.
+// It is a separate module, so myrpc does not depend on OpenTelemetry and its Go version.
+package myrpcotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/manhdaovan/myrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/manhdaovan/myrpc/myrpcotel"
+
+// Attribute keys of spans
+const (
+	attrSystem    = attribute.Key("messaging.system")
+	attrService   = attribute.Key("rpc.service")
+	attrMethod    = attribute.Key("rpc.method")
+	attrMessageID = attribute.Key("messaging.message.id")
+)
+
+// Tracer implements myrpc.Tracer on OpenTelemetry.
+// Span context is carried in message metadata in W3C traceparent/tracestate format.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures Tracer
+type Option func(*Tracer)
+
+// WithPropagator replaces propagator of span context, W3C trace context by default
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(t *Tracer) {
+		t.propagator = p
+	}
+}
+
+// New returns tracer that creates spans by given tracer provider,
+// or by global tracer provider if it is nil
+func New(tp trace.TracerProvider, opts ...Option) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	t := &Tracer{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// StartProducer starts span of sending a message to given method
+func (t *Tracer) StartProducer(ctx context.Context, svr myrpc.ServiceName, mth myrpc.MethodName) (context.Context, myrpc.Span) {
+	ctx, span := t.tracer.Start(ctx, string(mth)+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrSystem.String("myrpc"), attrService.String(string(svr)), attrMethod.String(string(mth))),
+	)
+
+	return ctx, &otelSpan{span: span}
+}
+
+// Inject puts span context of ctx into metadata of message
+func (t *Tracer) Inject(ctx context.Context, msg *myrpc.RPCMessage) {
+	t.propagator.Inject(ctx, metadataCarrier{msg: msg})
+}
+
+// StartConsumer extracts span context from metadata of message,
+// and starts span of handling the message as its child
+func (t *Tracer) StartConsumer(ctx context.Context, msg *myrpc.RPCMessage) (context.Context, myrpc.Span) {
+	ctx = t.propagator.Extract(ctx, metadataCarrier{msg: msg})
+	ctx, span := t.tracer.Start(ctx, string(msg.MthName)+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attrSystem.String("myrpc"),
+			attrService.String(string(msg.SvrName)),
+			attrMethod.String(string(msg.MthName)),
+			attrMessageID.String(msg.ID),
+		),
+	)
+
+	return ctx, &otelSpan{span: span}
+}
+
+// StartStep starts span of a step of handling message, which began at given time
+func (t *Tracer) StartStep(ctx context.Context, step string, start time.Time) (context.Context, myrpc.Span) {
+	ctx, span := t.tracer.Start(ctx, step, trace.WithTimestamp(start))
+
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// metadataCarrier adapts metadata of message to propagation.TextMapCarrier
+type metadataCarrier struct {
+	msg *myrpc.RPCMessage
+}
+
+func (c metadataCarrier) Get(key string) string {
+	return c.msg.Metadata[key]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	if c.msg.Metadata == nil {
+		c.msg.Metadata = make(map[string]string)
+	}
+	c.msg.Metadata[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Metadata))
+	for k := range c.msg.Metadata {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,96 @@
+package myrpcotel
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/manhdaovan/myrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceAcrossQueue(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := New(tp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := myrpc.NewMemoryQueue()
+
+	client := myrpc.NewRPCClient(ctx, q)
+	client.SetTracer(tracer)
+	parentCtx, parent := tp.Tracer("test").Start(ctx, "caller")
+	if err := client.SendAsyncMsgContext(parentCtx, "svc", "mth", "hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	msgs, err := q.ReceiveMsg()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("cannot receive message: %v", err)
+	}
+	msg := msgs[0]
+	if msg.Metadata["traceparent"] == "" {
+		t.Fatal("trace context is not propagated in metadata")
+	}
+
+	handled := make(chan trace.SpanContext, 1)
+	srvQueue := myrpc.NewMemoryQueue()
+	srv := myrpc.NewRPCServer(ctx, srvQueue, srvQueue)
+	srv.SetTracer(tracer)
+	srv.RegisterService(nil, "svc", myrpc.ServiceDescription{Name: "svc", Methods: map[myrpc.MethodName]myrpc.MethodDescription{
+		"mth": {Name: "mth", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			handled <- trace.SpanContextFromContext(ctx)
+			return nil, nil
+		}, DecodeHandle: func(dec myrpc.PayloadDecodeFnc, data []byte) (interface{}, error) {
+			var in string
+			return &in, json.Unmarshal(data, &in)
+		}},
+	}})
+	go srv.Serve()
+	// received message is handled by server of another queue
+	if err := srvQueue.SendAsyncMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	var handlerSpan trace.SpanContext
+	select {
+	case handlerSpan = <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not handled")
+	}
+	cancel()
+
+	spans := map[string]tracetest.SpanStub{}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range exporter.GetSpans() {
+			spans[s.Name] = s
+		}
+		if _, ok := spans["mth process"]; ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	producer, consumer, handle := spans["mth send"], spans["mth process"], spans["handle"]
+	if producer.SpanKind != trace.SpanKindProducer || consumer.SpanKind != trace.SpanKindConsumer {
+		t.Fatalf("unexpected span kinds: producer %s, consumer %s", producer.SpanKind, consumer.SpanKind)
+	}
+	if producer.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("producer span is not child of caller span")
+	}
+	if consumer.SpanContext.TraceID() != producer.SpanContext.TraceID() ||
+		consumer.Parent.SpanID() != producer.SpanContext.SpanID() || !consumer.Parent.IsRemote() {
+		t.Error("consumer span is not remote child of producer span")
+	}
+	if handle.Parent.SpanID() != consumer.SpanContext.SpanID() {
+		t.Error("handle step is not child of consumer span")
+	}
+	if handlerSpan.SpanID() != handle.SpanContext.SpanID() {
+		t.Error("handler context is not handle span context")
+	}
+}
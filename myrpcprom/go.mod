@@ -0,0 +1,11 @@
+module github.com/manhdaovan/myrpc/myrpcprom
+
+go 1.13
+
+require (
+	github.com/manhdaovan/myrpc v0.0.0
+	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+)
+
+replace github.com/manhdaovan/myrpc => ../
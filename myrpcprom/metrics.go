@@ -0,0 +1,236 @@
+// Package myrpcprom records metrics of myrpc server and client to Prometheus.
+// It is kept out of myrpc package, so myrpc does not depend on Prometheus.
+package myrpcprom
+
+import (
+	"time"
+
+	"github.com/manhdaovan/myrpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label names of metrics
+const (
+	labelService = "service"
+	labelMethod  = "method"
+	labelLane    = "lane"
+)
+
+// Metrics implements myrpc.Metrics on Prometheus
+type Metrics struct {
+	myrpc.NopMetrics
+
+	received       *prometheus.CounterVec
+	handled        *prometheus.CounterVec
+	failed         *prometheus.CounterVec
+	deleted        *prometheus.CounterVec
+	deadLettered   *prometheus.CounterVec
+	expired        *prometheus.CounterVec
+	handlerLatency *prometheus.HistogramVec
+	dwell          *prometheus.HistogramVec
+	batchSize      prometheus.Histogram
+	inFlight       prometheus.Gauge
+	sent           *prometheus.CounterVec
+	sendFailed     *prometheus.CounterVec
+	sendLatency    *prometheus.HistogramVec
+	lanePolls      *prometheus.CounterVec
+	laneReceived   *prometheus.CounterVec
+	laneFailed     *prometheus.CounterVec
+	laneDwell      *prometheus.HistogramVec
+	laneLatency    *prometheus.HistogramVec
+}
+
+// New returns metrics that are registered to given registerer, with given namespace
+func New(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	labels := []string{labelService, labelMethod}
+	laneLabels := []string{labelLane}
+	m := &Metrics{
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_received_total",
+			Help:      "Number of messages received by server.",
+		}, labels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_handled_total",
+			Help:      "Number of messages handled successfully by server.",
+		}, labels),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_failed_total",
+			Help:      "Number of messages failed to be handled by server.",
+		}, labels),
+		deleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_deleted_total",
+			Help:      "Number of messages deleted from the queue by server.",
+		}, labels),
+		deadLettered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_dead_lettered_total",
+			Help:      "Number of messages sent to dead letter queue by server.",
+		}, labels),
+		expired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "messages_expired_total",
+			Help:      "Number of messages expired before being handled by server.",
+		}, labels),
+		handlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "handler_duration_seconds",
+			Help:      "Time to handle a message.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+		dwell: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "queue_dwell_seconds",
+			Help:      "Time a message waited in the queue before being handled.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, labels),
+		batchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "receive_batch_size",
+			Help:      "Number of messages per receive.",
+			Buckets:   prometheus.LinearBuckets(0, 1, 11),
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "in_flight_handlers",
+			Help:      "Number of handlers that are running.",
+		}),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "messages_sent_total",
+			Help:      "Number of messages sent successfully by client.",
+		}, labels),
+		sendFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "messages_send_failed_total",
+			Help:      "Number of messages failed to be sent by client.",
+		}, labels),
+		sendLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "send_duration_seconds",
+			Help:      "Time to send a message.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+		lanePolls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "lane_polls_total",
+			Help:      "Number of polls of each priority lane.",
+		}, laneLabels),
+		laneReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "lane_messages_received_total",
+			Help:      "Number of messages received from each priority lane.",
+		}, laneLabels),
+		laneFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "lane_messages_failed_total",
+			Help:      "Number of messages of each priority lane failed to be handled.",
+		}, laneLabels),
+		laneDwell: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "lane_dwell_seconds",
+			Help:      "Time a message waited in each priority lane before being handled.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, laneLabels),
+		laneLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "lane_handler_duration_seconds",
+			Help:      "Time to handle a message of each priority lane.",
+			Buckets:   prometheus.DefBuckets,
+		}, laneLabels),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.received, m.handled, m.failed, m.deleted, m.deadLettered, m.expired,
+		m.handlerLatency, m.dwell, m.batchSize, m.inFlight,
+		m.sent, m.sendFailed, m.sendLatency,
+		m.lanePolls, m.laneReceived, m.laneFailed, m.laneDwell, m.laneLatency,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) BatchReceived(size int) {
+	m.batchSize.Observe(float64(size))
+}
+
+func (m *Metrics) MsgReceived(svr myrpc.ServiceName, mth myrpc.MethodName, dwell time.Duration) {
+	m.received.WithLabelValues(string(svr), string(mth)).Inc()
+	if dwell > 0 {
+		m.dwell.WithLabelValues(string(svr), string(mth)).Observe(dwell.Seconds())
+	}
+}
+
+func (m *Metrics) MsgHandled(svr myrpc.ServiceName, mth myrpc.MethodName, latency time.Duration, err error) {
+	m.handlerLatency.WithLabelValues(string(svr), string(mth)).Observe(latency.Seconds())
+	if err != nil {
+		m.failed.WithLabelValues(string(svr), string(mth)).Inc()
+		return
+	}
+	m.handled.WithLabelValues(string(svr), string(mth)).Inc()
+}
+
+func (m *Metrics) MsgDeleted(svr myrpc.ServiceName, mth myrpc.MethodName) {
+	m.deleted.WithLabelValues(string(svr), string(mth)).Inc()
+}
+
+func (m *Metrics) MsgDeadLettered(svr myrpc.ServiceName, mth myrpc.MethodName) {
+	m.deadLettered.WithLabelValues(string(svr), string(mth)).Inc()
+}
+
+func (m *Metrics) MsgExpired(svr myrpc.ServiceName, mth myrpc.MethodName) {
+	m.expired.WithLabelValues(string(svr), string(mth)).Inc()
+}
+
+func (m *Metrics) InFlight(delta int) {
+	m.inFlight.Add(float64(delta))
+}
+
+func (m *Metrics) MsgSent(svr myrpc.ServiceName, mth myrpc.MethodName, latency time.Duration, err error) {
+	m.sendLatency.WithLabelValues(string(svr), string(mth)).Observe(latency.Seconds())
+	if err != nil {
+		m.sendFailed.WithLabelValues(string(svr), string(mth)).Inc()
+		return
+	}
+	m.sent.WithLabelValues(string(svr), string(mth)).Inc()
+}
+
+func (m *Metrics) LanePolled(lane myrpc.Priority, size int) {
+	m.lanePolls.WithLabelValues(string(lane)).Inc()
+	m.laneReceived.WithLabelValues(string(lane)).Add(float64(size))
+}
+
+func (m *Metrics) LaneHandled(lane myrpc.Priority, dwell, latency time.Duration, err error) {
+	if dwell > 0 {
+		m.laneDwell.WithLabelValues(string(lane)).Observe(dwell.Seconds())
+	}
+	m.laneLatency.WithLabelValues(string(lane)).Observe(latency.Seconds())
+	if err != nil {
+		m.laneFailed.WithLabelValues(string(lane)).Inc()
+	}
+}
@@ -0,0 +1,168 @@
+package myrpcprom
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manhdaovan/myrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gathered returns values of all metrics of given registry, by name and labels such as
+// myrpc_server_messages_received_total{method="mth",service="svc"}.
+// Value of histogram is its sample count, and its sum is by name with suffix "_sum".
+func gathered(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := make([]string, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+`"`+l.GetValue()+`"`)
+			}
+			sort.Strings(labels)
+			key := "{" + strings.Join(labels, ",") + "}"
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				values[f.GetName()+key] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				values[f.GetName()+key] = m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				values[f.GetName()+key] = float64(m.GetHistogram().GetSampleCount())
+				values[f.GetName()+"_sum"+key] = m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	const svc = `{method="mth",service="svc"}`
+	tests := []struct {
+		name   string
+		record func(m *Metrics)
+		want   map[string]float64
+	}{
+		{"received", func(m *Metrics) {
+			m.MsgReceived("svc", "mth", 2*time.Second)
+			m.MsgReceived("svc", "mth", 0)
+		}, map[string]float64{
+			"myrpc_server_messages_received_total" + svc: 2,
+			// dwell is unknown for message without sent time
+			"myrpc_server_queue_dwell_seconds" + svc:     1,
+			"myrpc_server_queue_dwell_seconds_sum" + svc: 2,
+		}},
+		{"handled", func(m *Metrics) {
+			m.MsgHandled("svc", "mth", time.Second, nil)
+			m.MsgHandled("svc", "mth", 3*time.Second, errors.New("failed"))
+		}, map[string]float64{
+			"myrpc_server_messages_handled_total" + svc:       1,
+			"myrpc_server_messages_failed_total" + svc:        1,
+			"myrpc_server_handler_duration_seconds" + svc:     2,
+			"myrpc_server_handler_duration_seconds_sum" + svc: 4,
+		}},
+		{"deleted", func(m *Metrics) { m.MsgDeleted("svc", "mth") }, map[string]float64{
+			"myrpc_server_messages_deleted_total" + svc: 1,
+		}},
+		{"dead-lettered", func(m *Metrics) {
+			m.MsgDeadLettered("svc", "mth")
+			m.MsgDeadLettered("svc", "mth")
+		}, map[string]float64{
+			"myrpc_server_messages_dead_lettered_total" + svc: 2,
+		}},
+		{"expired", func(m *Metrics) { m.MsgExpired("svc", "mth") }, map[string]float64{
+			"myrpc_server_messages_expired_total" + svc: 1,
+		}},
+		{"batch and in flight", func(m *Metrics) {
+			m.BatchReceived(3)
+			m.InFlight(2)
+			m.InFlight(-1)
+		}, map[string]float64{
+			"myrpc_server_receive_batch_size{}":     1,
+			"myrpc_server_receive_batch_size_sum{}": 3,
+			"myrpc_server_in_flight_handlers{}":     1,
+		}},
+		{"sent", func(m *Metrics) {
+			m.MsgSent("svc", "mth", time.Second, nil)
+			m.MsgSent("svc", "mth", time.Second, errors.New("failed"))
+		}, map[string]float64{
+			"myrpc_client_messages_sent_total" + svc:        1,
+			"myrpc_client_messages_send_failed_total" + svc: 1,
+			"myrpc_client_send_duration_seconds" + svc:      2,
+			"myrpc_client_send_duration_seconds_sum" + svc:  2,
+		}},
+		{"lanes", func(m *Metrics) {
+			m.LanePolled("high", 3)
+			m.LanePolled("high", 0)
+			m.LanePolled("low", 1)
+			m.LaneHandled("high", time.Second, 2*time.Second, nil)
+			m.LaneHandled("low", 0, time.Second, errors.New("failed"))
+		}, map[string]float64{
+			`myrpc_server_lane_polls_total{lane="high"}`:                  2,
+			`myrpc_server_lane_polls_total{lane="low"}`:                   1,
+			`myrpc_server_lane_messages_received_total{lane="high"}`:      3,
+			`myrpc_server_lane_messages_received_total{lane="low"}`:       1,
+			`myrpc_server_lane_messages_failed_total{lane="low"}`:         1,
+			`myrpc_server_lane_dwell_seconds{lane="high"}`:                1,
+			`myrpc_server_lane_dwell_seconds_sum{lane="high"}`:            1,
+			`myrpc_server_lane_handler_duration_seconds{lane="high"}`:     1,
+			`myrpc_server_lane_handler_duration_seconds_sum{lane="high"}`: 2,
+			`myrpc_server_lane_handler_duration_seconds{lane="low"}`:      1,
+			`myrpc_server_lane_handler_duration_seconds_sum{lane="low"}`:  1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m, err := New(reg, "myrpc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record(m)
+
+			got := gathered(t, reg)
+			// gauge without labels is always gathered
+			if _, ok := tt.want["myrpc_server_in_flight_handlers{}"]; !ok && got["myrpc_server_in_flight_handlers{}"] == 0 {
+				delete(got, "myrpc_server_in_flight_handlers{}")
+			}
+			if _, ok := tt.want["myrpc_server_receive_batch_size{}"]; !ok && got["myrpc_server_receive_batch_size{}"] == 0 {
+				delete(got, "myrpc_server_receive_batch_size{}")
+				delete(got, "myrpc_server_receive_batch_size_sum{}")
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+				delete(got, key)
+			}
+			for key, value := range got {
+				t.Errorf("unexpected %s = %v", key, value)
+			}
+		})
+	}
+}
+
+func TestNewRegistersOnce(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New(reg, "myrpc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(reg, "myrpc"); err == nil {
+		t.Error("metrics are registered twice to the same registry")
+	}
+	if _, err := New(reg, "other"); err != nil {
+		t.Errorf("metrics of other namespace are not registered: %v", err)
+	}
+}
+
+var _ myrpc.Metrics = (*Metrics)(nil)
@@ -0,0 +1,307 @@
+package myrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Priority is name of a lane of messages, see WithPriority
+type Priority string
+
+// Common priorities
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// PrioritySender sends messages to lanes by their priority.
+// Sender of a lane could be a RoutingSender, so a priority maps to a set of queues.
+// Messages without priority, or of priority without lane, are sent by the default sender.
+type PrioritySender struct {
+	locker        sync.RWMutex
+	defaultSender MessageSender
+	lanes         map[Priority]MessageSender
+}
+
+// NewPrioritySender returns priority sender that sends messages without lane by given default sender.
+// Default sender could be nil, then messages without lane are rejected.
+func NewPrioritySender(defaultSender MessageSender) *PrioritySender {
+	return &PrioritySender{
+		defaultSender: defaultSender,
+		lanes:         make(map[Priority]MessageSender),
+	}
+}
+
+// Lane sends messages of given priority by given sender
+func (ps *PrioritySender) Lane(p Priority, sender MessageSender) {
+	ps.locker.Lock()
+	ps.lanes[p] = sender
+	ps.locker.Unlock()
+}
+
+// SenderOf returns sender of messages of given priority
+func (ps *PrioritySender) SenderOf(p Priority) (MessageSender, error) {
+	ps.locker.RLock()
+	defer ps.locker.RUnlock()
+
+	if sender, ok := ps.lanes[p]; ok {
+		return sender, nil
+	}
+	if ps.defaultSender == nil {
+		return nil, errors.Errorf("no lane for priority %q", p)
+	}
+
+	return ps.defaultSender, nil
+}
+
+// SendAsyncMsg sends message by sender of its lane
+func (ps *PrioritySender) SendAsyncMsg(msg *RPCMessage) error {
+	return dispatchSender{ps}.SendAsyncMsg(msg)
+}
+
+// SendAsyncMsgContext sends message by sender of its lane within given ctx, if that sender supports it
+func (ps *PrioritySender) SendAsyncMsgContext(ctx context.Context, msg *RPCMessage) error {
+	return dispatchSender{ps}.SendAsyncMsgContext(ctx, msg)
+}
+
+// SendSyncMsg sends message by sender of its lane, and waits for response
+func (ps *PrioritySender) SendSyncMsg(msg *RPCMessage, out interface{}) error {
+	return dispatchSender{ps}.SendSyncMsg(msg, out)
+}
+
+// SendDelayedMsg sends message by sender of its lane, with delay capped at maximum delay of that sender
+func (ps *PrioritySender) SendDelayedMsg(msg *RPCMessage, delay time.Duration) error {
+	return dispatchSender{ps}.SendDelayedMsg(msg, delay)
+}
+
+// MaxDelay returns the longest maximum delay of all senders.
+// Delay is capped again by sender of each message.
+func (ps *PrioritySender) MaxDelay() time.Duration {
+	return dispatchSender{ps}.MaxDelay()
+}
+
+func (ps *PrioritySender) senderOfMsg(msg *RPCMessage) (MessageSender, error) {
+	return ps.SenderOf(msg.Priority)
+}
+
+func (ps *PrioritySender) allSenders() []MessageSender {
+	ps.locker.RLock()
+	defer ps.locker.RUnlock()
+
+	senders := []MessageSender{ps.defaultSender}
+	for _, sender := range ps.lanes {
+		senders = append(senders, sender)
+	}
+
+	return senders
+}
+
+// PriorityMode is the way PriorityReceiver chooses lane to poll
+type PriorityMode string
+
+// Modes of PriorityReceiver
+const (
+	// PriorityStrict polls lanes in order, and polls a lane only if all higher lanes are empty.
+	// Lower lanes are starved while higher lanes are busy.
+	PriorityStrict PriorityMode = "strict"
+	// PriorityWeighted polls lanes by weighted round robin, so each lane has its share of polls.
+	// Other lanes are polled in order if the chosen lane is empty.
+	PriorityWeighted PriorityMode = "weighted"
+)
+
+// DefaultPriorityIdleWait is the time PriorityReceiver waits when all lanes are empty
+const DefaultPriorityIdleWait = time.Second
+
+// Lane is a queue of messages of a priority
+type Lane struct {
+	Priority Priority
+	Receiver MessageReceiver
+	Deleter  MessageDeleter
+	// Requeue sends delayed messages back to the lane, see PriorityReceiver.RequeueSender
+	Requeue MessageSender
+	// Weight is share of polls of lane in PriorityWeighted mode, 1 if not positive
+	Weight int
+}
+
+// PriorityReceiver receives messages from lanes by their priorities, and deletes them from their lanes.
+// Receivers of lanes should not wait for messages (such as SQS long polling),
+// or a busy lower lane waits for an empty higher lane.
+type PriorityReceiver struct {
+	ctx      context.Context
+	locker   sync.Mutex
+	mode     PriorityMode
+	lanes    []Lane
+	credits  []int
+	metrics  Metrics
+	idleWait time.Duration
+}
+
+// NewPriorityReceiver returns receiver of given lanes, from highest to lowest priority.
+// Waiting for messages is stopped when given ctx is done.
+func NewPriorityReceiver(ctx context.Context, mode PriorityMode, lanes ...Lane) (*PriorityReceiver, error) {
+	if mode != PriorityStrict && mode != PriorityWeighted {
+		return nil, errors.Errorf("unknown priority mode: %q", mode)
+	}
+	if len(lanes) == 0 {
+		return nil, errors.New("no lane of priority receiver")
+	}
+
+	lanes = append([]Lane{}, lanes...)
+	seen := make(map[Priority]bool, len(lanes))
+	for i, lane := range lanes {
+		if seen[lane.Priority] {
+			return nil, errors.Errorf("duplicated lane of priority %q", lane.Priority)
+		}
+		seen[lane.Priority] = true
+		if lane.Weight <= 0 {
+			lanes[i].Weight = 1
+		}
+	}
+
+	return &PriorityReceiver{
+		ctx:      ctx,
+		mode:     mode,
+		lanes:    lanes,
+		credits:  make([]int, len(lanes)),
+		metrics:  NopMetrics{},
+		idleWait: DefaultPriorityIdleWait,
+	}, nil
+}
+
+// SetMetrics replaces metrics of priority receiver
+func (pr *PriorityReceiver) SetMetrics(metrics Metrics) {
+	pr.locker.Lock()
+	pr.metrics = metrics
+	pr.locker.Unlock()
+}
+
+// SetIdleWait replaces time to wait when all lanes are empty, DefaultPriorityIdleWait by default
+func (pr *PriorityReceiver) SetIdleWait(wait time.Duration) {
+	pr.locker.Lock()
+	pr.idleWait = wait
+	pr.locker.Unlock()
+}
+
+// ReceiveMsg receives messages from the first non-empty lane, in order of priority mode.
+// It waits idle wait, or until ctx of receiver is done, and returns no message if all lanes are empty.
+func (pr *PriorityReceiver) ReceiveMsg() ([]*RPCMessage, error) {
+	pr.locker.Lock()
+	order := pr.pollOrder()
+	metrics, idleWait := pr.metrics, pr.idleWait
+	pr.locker.Unlock()
+
+	for _, i := range order {
+		lane := pr.lanes[i]
+		msgs, err := lane.Receiver.ReceiveMsg()
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot receive message from lane %s", lane.Priority)
+		}
+		metrics.LanePolled(lane.Priority, len(msgs))
+		if len(msgs) == 0 {
+			continue
+		}
+
+		for _, msg := range msgs {
+			msg.lane = lane.Priority
+		}
+		return msgs, nil
+	}
+
+	timer := time.NewTimer(idleWait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-pr.ctx.Done():
+	}
+
+	return nil, nil
+}
+
+// pollOrder returns indexes of lanes in order to poll
+func (pr *PriorityReceiver) pollOrder() []int {
+	order := make([]int, 0, len(pr.lanes))
+	if pr.mode == PriorityWeighted {
+		// smooth weighted round robin: the lane with most credits is chosen,
+		// then pays back total weight
+		chosen, total := 0, 0
+		for i, lane := range pr.lanes {
+			pr.credits[i] += lane.Weight
+			total += lane.Weight
+			if pr.credits[i] > pr.credits[chosen] {
+				chosen = i
+			}
+		}
+		pr.credits[chosen] -= total
+		order = append(order, chosen)
+	}
+
+	for i := range pr.lanes {
+		if len(order) == 0 || order[0] != i {
+			order = append(order, i)
+		}
+	}
+
+	return order
+}
+
+// DeleteMsg deletes message from the lane it is received from
+func (pr *PriorityReceiver) DeleteMsg(msg *RPCMessage) error {
+	for _, lane := range pr.lanes {
+		if lane.Priority != msg.lane {
+			continue
+		}
+		if lane.Deleter == nil {
+			return nil
+		}
+		return lane.Deleter.DeleteMsg(msg)
+	}
+
+	return errors.Errorf("message %s is not received from any lane", msg.ID)
+}
+
+// RequeueSender returns sender that sends delayed messages back to the lanes they are received from,
+// by Requeue senders of lanes. It is the requeue sender of the queue of this receiver on RPCServer.
+func (pr *PriorityReceiver) RequeueSender() MessageSender {
+	return dispatchSender{laneRequeue{pr}}
+}
+
+// laneRequeue selects Requeue sender of lane of message
+type laneRequeue struct {
+	pr *PriorityReceiver
+}
+
+func (lr laneRequeue) senderOfMsg(msg *RPCMessage) (MessageSender, error) {
+	for _, lane := range lr.pr.lanes {
+		if lane.Priority == msg.lane && lane.Requeue != nil {
+			return lane.Requeue, nil
+		}
+	}
+
+	return nil, errors.Errorf("no requeue sender of lane %q", msg.lane)
+}
+
+func (lr laneRequeue) allSenders() []MessageSender {
+	senders := make([]MessageSender, len(lr.pr.lanes))
+	for i, lane := range lr.pr.lanes {
+		senders[i] = lane.Requeue
+	}
+
+	return senders
+}
+
+// CheckHealth checks receivers of all lanes that support health check
+func (pr *PriorityReceiver) CheckHealth() error {
+	for _, lane := range pr.lanes {
+		if hc, ok := lane.Receiver.(HealthChecker); ok {
+			if err := hc.CheckHealth(); err != nil {
+				return errors.Wrapf(err, "lane %s is unhealthy", lane.Priority)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package myrpc
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// laneReceiver returns one message on each receive while busy
+type laneReceiver struct {
+	busy bool
+}
+
+func (lr *laneReceiver) ReceiveMsg() ([]*RPCMessage, error) {
+	if !lr.busy {
+		return nil, nil
+	}
+
+	return []*RPCMessage{{ID: newID()}}, nil
+}
+
+// laneMetrics records polls of lanes
+type laneMetrics struct {
+	NopMetrics
+	locker sync.Mutex
+	polls  []string
+}
+
+func (lm *laneMetrics) LanePolled(lane Priority, size int) {
+	lm.locker.Lock()
+	defer lm.locker.Unlock()
+	lm.polls = append(lm.polls, string(lane)+"="+strconv.Itoa(size))
+}
+
+func newTestPriorityReceiver(t *testing.T, mode PriorityMode, weights []int, busy []bool) *PriorityReceiver {
+	t.Helper()
+	lanes := make([]Lane, len(weights))
+	for i := range lanes {
+		lanes[i] = Lane{Priority: Priority(string(rune('a' + i))), Receiver: &laneReceiver{busy: busy[i]}, Weight: weights[i]}
+	}
+	pr, err := NewPriorityReceiver(context.Background(), mode, lanes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetIdleWait(0)
+
+	return pr
+}
+
+func TestPollOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    PriorityMode
+		weights []int
+		want    [][]int
+	}{
+		{"strict", PriorityStrict, []int{3, 1, 1}, [][]int{{0, 1, 2}, {0, 1, 2}, {0, 1, 2}}},
+		{"weighted by equal weights", PriorityWeighted, []int{1, 1, 1}, [][]int{{0, 1, 2}, {1, 0, 2}, {2, 0, 1}, {0, 1, 2}}},
+		{"weighted 3:1", PriorityWeighted, []int{3, 1}, [][]int{{0, 1}, {0, 1}, {1, 0}, {0, 1}, {0, 1}}},
+		{"weighted 1:2", PriorityWeighted, []int{1, 2}, [][]int{{1, 0}, {0, 1}, {1, 0}}},
+		{"non positive weight is 1", PriorityWeighted, []int{0, -1}, [][]int{{0, 1}, {1, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := newTestPriorityReceiver(t, tt.mode, tt.weights, make([]bool, len(tt.weights)))
+			for i, want := range tt.want {
+				if got := pr.pollOrder(); !reflect.DeepEqual(got, want) {
+					t.Errorf("pollOrder() #%d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPriorityReceiverFairness(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    PriorityMode
+		weights []int
+		busy    []bool
+		want    map[Priority]int
+	}{
+		{"strict starves lower lanes", PriorityStrict, []int{1, 1}, []bool{true, true}, map[Priority]int{"a": 100}},
+		{"strict falls through empty lanes", PriorityStrict, []int{1, 1, 1}, []bool{false, false, true}, map[Priority]int{"c": 100}},
+		{"weighted shares by weight", PriorityWeighted, []int{3, 1}, []bool{true, true}, map[Priority]int{"a": 75, "b": 25}},
+		{"weighted does not starve lowest lane", PriorityWeighted, []int{8, 1, 1}, []bool{true, true, true},
+			map[Priority]int{"a": 80, "b": 10, "c": 10}},
+		{"weighted gives share of empty lane to others", PriorityWeighted, []int{1, 1}, []bool{false, true}, map[Priority]int{"b": 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := newTestPriorityReceiver(t, tt.mode, tt.weights, tt.busy)
+			got := make(map[Priority]int)
+			for i := 0; i < 100; i++ {
+				msgs, err := pr.ReceiveMsg()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, msg := range msgs {
+					got[msg.lane]++
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messages by lane = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityReceiverLaneMetrics(t *testing.T) {
+	pr := newTestPriorityReceiver(t, PriorityStrict, []int{1, 1, 1}, []bool{false, true, false})
+	metrics := &laneMetrics{}
+	pr.SetMetrics(metrics)
+
+	for i := 0; i < 2; i++ {
+		if _, err := pr.ReceiveMsg(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pr.lanes[1].Receiver.(*laneReceiver).busy = false
+	if _, err := pr.ReceiveMsg(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a=0", "b=1", "a=0", "b=1", "a=0", "b=0", "c=0"}
+	if !reflect.DeepEqual(metrics.polls, want) {
+		t.Errorf("polls of lanes = %v, want %v", metrics.polls, want)
+	}
+}
+
+func TestPriorityReceiverIdleWaitStopsOnDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, err := NewPriorityReceiver(ctx, PriorityStrict, Lane{Priority: "a", Receiver: &laneReceiver{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetIdleWait(time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if msgs, err := pr.ReceiveMsg(); err != nil || len(msgs) != 0 {
+			t.Errorf("ReceiveMsg() = %v, %v, want no message", msgs, err)
+		}
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReceiveMsg() waits idle wait after ctx is done")
+	}
+}
@@ -0,0 +1,244 @@
+package myrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Publisher is the interface to publish message to a topic.
+// Every consumer group subscribed to the topic receives its own copy of message.
+type Publisher interface {
+	Publish(topic string, msg *RPCMessage) error
+}
+
+// ContextPublisher is the interface of publisher that publishes message within context of each call
+type ContextPublisher interface {
+	PublishContext(ctx context.Context, topic string, msg *RPCMessage) error
+}
+
+// Subscription receives and deletes copies of messages published to a topic, for a consumer group.
+// It is served by RPCServer.AddQueue like any other queue.
+type Subscription interface {
+	MessageReceiver
+	MessageDeleter
+}
+
+// Defaults of MemoryQueue
+const (
+	DefaultMemoryVisibilityTimeout = 30 * time.Second
+	memoryReceiveWait              = time.Second
+	localBatchSize                 = 10
+)
+
+// MemoryBroker is an in-memory Publisher, for tests and local development
+type MemoryBroker struct {
+	locker sync.Mutex
+	// queues of consumer groups by topic
+	topics map[string]map[string]*MemoryQueue
+}
+
+// NewMemoryBroker returns an empty in-memory broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{topics: make(map[string]map[string]*MemoryQueue)}
+}
+
+// Subscribe returns queue of given consumer group of given topic, creating it if needed.
+// Messages published before subscription are not received.
+func (b *MemoryBroker) Subscribe(topic, group string) *MemoryQueue {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	groups, ok := b.topics[topic]
+	if !ok {
+		groups = make(map[string]*MemoryQueue)
+		b.topics[topic] = groups
+	}
+	q, ok := groups[group]
+	if !ok {
+		q = NewMemoryQueue()
+		groups[group] = q
+	}
+
+	return q
+}
+
+// Publish sends a copy of message to queue of each consumer group of given topic.
+// Message is dropped if there is no subscription.
+func (b *MemoryBroker) Publish(topic string, msg *RPCMessage) error {
+	b.locker.Lock()
+	queues := make([]*MemoryQueue, 0, len(b.topics[topic]))
+	for _, q := range b.topics[topic] {
+		queues = append(queues, q)
+	}
+	b.locker.Unlock()
+
+	for _, q := range queues {
+		if err := q.SendAsyncMsg(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MemoryQueue is an in-memory queue with visibility timeout, for tests and local development.
+// Received messages are redelivered after visibility timeout unless they are deleted.
+type MemoryQueue struct {
+	locker            sync.Mutex
+	ready             []*RPCMessage
+	inFlight          map[string]memoryInFlight
+	notify            chan struct{}
+	visibilityTimeout time.Duration
+}
+
+type memoryInFlight struct {
+	msg      *RPCMessage
+	deadline time.Time
+}
+
+// NewMemoryQueue returns an empty in-memory queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		inFlight:          make(map[string]memoryInFlight),
+		notify:            make(chan struct{}, 1),
+		visibilityTimeout: DefaultMemoryVisibilityTimeout,
+	}
+}
+
+// SetVisibilityTimeout replaces time that received messages are hidden before redelivery
+func (q *MemoryQueue) SetVisibilityTimeout(timeout time.Duration) {
+	q.locker.Lock()
+	q.visibilityTimeout = timeout
+	q.locker.Unlock()
+}
+
+// SendAsyncMsg puts a copy of message to the queue
+func (q *MemoryQueue) SendAsyncMsg(msg *RPCMessage) error {
+	if msg == nil {
+		return errors.New("nil msg is given to SendAsyncMsg")
+	}
+
+	c := copyMsg(msg)
+	c.sentAt = time.Now()
+	q.locker.Lock()
+	q.ready = append(q.ready, c)
+	q.locker.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// SendSyncMsg is not supported
+func (q *MemoryQueue) SendSyncMsg(msg *RPCMessage, out interface{}) error {
+	return errors.New("memory queue not support request/reply pattern")
+}
+
+// ReceiveMsg returns ready messages, waiting up to a second if there is none
+func (q *MemoryQueue) ReceiveMsg() ([]*RPCMessage, error) {
+	if msgs := q.receive(); len(msgs) > 0 {
+		return msgs, nil
+	}
+
+	timer := time.NewTimer(memoryReceiveWait)
+	defer timer.Stop()
+	select {
+	case <-q.notify:
+	case <-timer.C:
+	}
+
+	return q.receive(), nil
+}
+
+func (q *MemoryQueue) receive() []*RPCMessage {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	now := time.Now()
+	for receipt, f := range q.inFlight {
+		if now.After(f.deadline) {
+			delete(q.inFlight, receipt)
+			q.ready = append(q.ready, f.msg)
+		}
+	}
+
+	n := len(q.ready)
+	if n > localBatchSize {
+		n = localBatchSize
+	}
+	msgs := make([]*RPCMessage, n)
+	for i, msg := range q.ready[:n] {
+		msg.attempt++
+		receipt := newID()
+		q.inFlight[receipt] = memoryInFlight{msg: msg, deadline: now.Add(q.visibilityTimeout)}
+
+		// handlers get their own copy
+		msgs[i] = copyMsg(msg)
+		msgs[i].attempt = msg.attempt
+		msgs[i].sentAt = msg.sentAt
+		msgs[i].msgReceiptHandle = receipt
+	}
+	q.ready = q.ready[n:]
+
+	return msgs
+}
+
+// DeleteMsg deletes received message, so it is not redelivered
+func (q *MemoryQueue) DeleteMsg(msg *RPCMessage) error {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if _, ok := q.inFlight[msg.msgReceiptHandle]; !ok {
+		return errors.Errorf("message %s is not in flight", msg.ID)
+	}
+	delete(q.inFlight, msg.msgReceiptHandle)
+
+	return nil
+}
+
+// Len returns number of messages in the queue, including in flight ones
+func (q *MemoryQueue) Len() int {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return len(q.ready) + len(q.inFlight)
+}
+
+// copyMsg returns copy of exported fields of message
+func copyMsg(msg *RPCMessage) *RPCMessage {
+	c := &RPCMessage{
+		ID:            msg.ID,
+		SvrName:       msg.SvrName,
+		MthName:       msg.MthName,
+		Topic:         msg.Topic,
+		Payload:       msg.Payload,
+		PayloadRef:    msg.PayloadRef,
+		PayloadDigest: msg.PayloadDigest,
+		Compression:   msg.Compression,
+		Encryption:    msg.Encryption,
+		Timestamp:     msg.Timestamp,
+		Signature:     msg.Signature,
+		GroupID:       msg.GroupID,
+		DedupID:       msg.DedupID,
+		DeliverAt:     msg.DeliverAt,
+		Priority:      msg.Priority,
+		ReplyTo:       msg.ReplyTo,
+		CorrelationID: msg.CorrelationID,
+		ReplyError:    msg.ReplyError,
+		Deadline:      msg.Deadline,
+	}
+	if msg.Metadata != nil {
+		c.Metadata = make(map[string]string, len(msg.Metadata))
+		for k, v := range msg.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,258 @@
+package myrpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of FileBroker
+const (
+	DefaultFileVisibilityTimeout = 30 * time.Second
+	DefaultFilePollInterval      = 200 * time.Millisecond
+)
+
+const (
+	fileReadyExt    = ".json"
+	fileInFlightExt = ".inflight"
+	fileTmpExt      = ".tmp"
+)
+
+// FileBroker is a Publisher on local filesystem, for tests and local development.
+// Each consumer group of a topic is a directory DIR/TOPIC/GROUP, and each message is a file in it,
+// so publishers and subscribers could be different processes on the same host.
+type FileBroker struct {
+	dir string
+}
+
+// NewFileBroker returns broker of topics in given directory, creating it if needed
+func NewFileBroker(dir string) (*FileBroker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create broker directory %s", dir)
+	}
+
+	return &FileBroker{dir: dir}, nil
+}
+
+// Subscribe returns queue of given consumer group of given topic, creating it if needed.
+// Messages published before subscription are not received.
+func (b *FileBroker) Subscribe(topic, group string) (*FileQueue, error) {
+	dir := filepath.Join(b.dir, topic, group)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create subscription directory %s", dir)
+	}
+
+	return &FileQueue{
+		dir:               dir,
+		visibilityTimeout: DefaultFileVisibilityTimeout,
+		pollInterval:      DefaultFilePollInterval,
+	}, nil
+}
+
+// Publish writes a copy of message to directory of each consumer group of given topic.
+// Message is dropped if there is no subscription.
+func (b *FileBroker) Publish(topic string, msg *RPCMessage) error {
+	groups, err := ioutil.ReadDir(filepath.Join(b.dir, topic))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot list subscriptions of topic %s", topic)
+	}
+
+	for _, group := range groups {
+		if !group.IsDir() {
+			continue
+		}
+		q := &FileQueue{dir: filepath.Join(b.dir, topic, group.Name())}
+		if err := q.SendAsyncMsg(msg); err != nil {
+			return errors.Wrapf(err, "cannot publish to group %s", group.Name())
+		}
+	}
+
+	return nil
+}
+
+// FileQueue is a queue in a directory, one file per message.
+// Received messages are renamed to in-flight files, and are redelivered after visibility timeout
+// unless they are deleted. Several processes could receive from the same queue.
+type FileQueue struct {
+	dir               string
+	visibilityTimeout time.Duration
+	pollInterval      time.Duration
+}
+
+// SetVisibilityTimeout replaces time that received messages are hidden before redelivery
+func (q *FileQueue) SetVisibilityTimeout(timeout time.Duration) {
+	q.visibilityTimeout = timeout
+}
+
+// SetPollInterval replaces time to wait when the queue is empty
+func (q *FileQueue) SetPollInterval(interval time.Duration) {
+	q.pollInterval = interval
+}
+
+// SendAsyncMsg writes message to a new file of the queue.
+// The file is written under a temporary name first, so it is never received half written.
+func (q *FileQueue) SendAsyncMsg(msg *RPCMessage) error {
+	if msg == nil {
+		return errors.New("nil msg is given to SendAsyncMsg")
+	}
+
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert msg %s to json", msg.ID)
+	}
+
+	// name is ordered by time, then carries number of attempts
+	name := fmt.Sprintf("%020d-%s-0", time.Now().UnixNano(), newID())
+	tmp := filepath.Join(q.dir, name+fileTmpExt)
+	if err := ioutil.WriteFile(tmp, []byte(msgJSON), 0644); err != nil {
+		return errors.Wrapf(err, "cannot write msg %s", msg.ID)
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name+fileReadyExt)); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "cannot write msg %s", msg.ID)
+	}
+
+	return nil
+}
+
+// SendSyncMsg is not supported
+func (q *FileQueue) SendSyncMsg(msg *RPCMessage, out interface{}) error {
+	return errors.New("file queue not support request/reply pattern")
+}
+
+// ReceiveMsg claims ready files of the queue, oldest first.
+// It waits poll interval and returns no message if the queue is empty.
+func (q *FileQueue) ReceiveMsg() ([]*RPCMessage, error) {
+	if err := q.restoreExpired(); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot list queue %s", q.dir)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	var msgs []*RPCMessage
+	for _, f := range files {
+		if len(msgs) == localBatchSize {
+			break
+		}
+		name := strings.TrimSuffix(f.Name(), fileReadyExt)
+		if name == f.Name() {
+			continue
+		}
+
+		msg, err := q.claim(name)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) == 0 {
+		time.Sleep(q.pollInterval)
+	}
+
+	return msgs, nil
+}
+
+// claim renames ready file of given name to in-flight file with one more attempt, then reads it.
+// It returns nil message if the file is claimed by another receiver.
+func (q *FileQueue) claim(name string) (*RPCMessage, error) {
+	base, attempt := splitAttempt(name)
+	attempt++
+	// visibility timeout starts from claim, and time of claim is in the name,
+	// so other receivers never see an in-flight file without it
+	inFlight := filepath.Join(q.dir, fmt.Sprintf("%s-%d-%d%s", base, attempt, time.Now().UnixNano(), fileInFlightExt))
+	if err := os.Rename(filepath.Join(q.dir, name+fileReadyExt), inFlight); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot claim msg file %s", name)
+	}
+
+	data, err := ioutil.ReadFile(inFlight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read msg file %s", name)
+	}
+	msg, err := JSONToRPCMsg(string(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot convert msg file %s to RPCMessage", name)
+	}
+	msg.msgReceiptHandle = inFlight
+	msg.attempt = attempt
+
+	return msg, nil
+}
+
+// restoreExpired makes in-flight files ready again after visibility timeout
+func (q *FileQueue) restoreExpired() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return errors.Wrapf(err, "cannot list queue %s", q.dir)
+	}
+
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), fileInFlightExt)
+		if name == f.Name() {
+			continue
+		}
+		name, claimedAt := splitClaimTime(name)
+		if time.Since(claimedAt) < q.visibilityTimeout {
+			continue
+		}
+		err := os.Rename(filepath.Join(q.dir, f.Name()), filepath.Join(q.dir, name+fileReadyExt))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "cannot restore msg file %s", name)
+		}
+	}
+
+	return nil
+}
+
+// DeleteMsg deletes file of received message, so it is not redelivered
+func (q *FileQueue) DeleteMsg(msg *RPCMessage) error {
+	if err := os.Remove(msg.msgReceiptHandle); err != nil {
+		return errors.Wrapf(err, "cannot delete msg %s", msg.ID)
+	}
+
+	return nil
+}
+
+// splitClaimTime splits name of in-flight file into name of its ready file and time of claim
+func splitClaimTime(name string) (string, time.Time) {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return name, time.Time{}
+	}
+	nano, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return name, time.Time{}
+	}
+
+	return name[:i], time.Unix(0, nano)
+}
+
+// splitAttempt splits name of message file into its base and number of attempts
+func splitAttempt(name string) (string, int) {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return name, 0
+	}
+	attempt, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return name, 0
+	}
+
+	return name[:i], attempt
+}
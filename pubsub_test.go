@@ -0,0 +1,111 @@
+package myrpc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOffloadedPublishToGroups(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewMemoryBroker()
+	var handled int32
+	var queues []*MemoryQueue
+	for _, group := range []string{"billing", "shipping"} {
+		q := broker.Subscribe("orders", group)
+		queues = append(queues, q)
+		srv := NewRPCServer(ctx, q, q)
+		srv.UseBlobStore(store)
+		srv.SetRetryPolicy(3)
+		srv.RegisterTopic("orders", nil, MethodDescription{Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			atomic.AddInt32(&handled, 1)
+			return nil, nil
+		}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+			var in string
+			return &in, dec(data, &in)
+		}})
+		go srv.Serve()
+	}
+
+	c := NewRPCClient(ctx, nil)
+	c.UsePublisher(broker)
+	c.UseBlobStore(store, 10)
+	if err := c.Publish("orders", strings.Repeat("a", 100), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "both groups handled message", func() bool {
+		return atomic.LoadInt32(&handled) == 2 && queues[0].Len() == 0 && queues[1].Len() == 0
+	})
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d blobs are left, want shared blob kept", len(files))
+	}
+}
+
+func TestFileQueueVisibilityFromClaim(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	broker, err := NewFileBroker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := broker.Subscribe("orders", "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.SetPollInterval(0)
+	q.SetVisibilityTimeout(time.Minute)
+	if err := broker.Publish("orders", &RPCMessage{ID: newID(), SvrName: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ready file published long ago keeps its old mtime when it is claimed
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files of queue = %v, %v", files, err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(q.dir, files[0].Name()), old, old); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := q.ReceiveMsg()
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ReceiveMsg() = %v, %v", msgs, err)
+	}
+
+	// another receiver does not restore message claimed within visibility timeout
+	other := &FileQueue{dir: q.dir, visibilityTimeout: time.Minute}
+	if msgs, err := other.ReceiveMsg(); err != nil || len(msgs) != 0 {
+		t.Fatalf("message claimed just now is received again: %v, %v", msgs, err)
+	}
+
+	// but restores it after visibility timeout from claim, with one more attempt
+	other.SetVisibilityTimeout(time.Nanosecond)
+	msgs, err = other.ReceiveMsg()
+	if err != nil || len(msgs) != 1 || msgs[0].attempt != 2 {
+		t.Fatalf("ReceiveMsg() after visibility timeout = %v, %v, want second attempt", msgs, err)
+	}
+	if err := other.DeleteMsg(msgs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := ioutil.ReadDir(q.dir); err != nil || len(files) != 0 {
+		t.Errorf("files of queue after delete = %d, %v", len(files), err)
+	}
+}
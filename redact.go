@@ -0,0 +1,115 @@
+package myrpc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// redacted replaces secrets in formatted configs
+const redacted = "[REDACTED]"
+
+// PayloadRedactFnc returns a safe form of payload to put in errors and logs
+type PayloadRedactFnc func(payload []byte) string
+
+// payloadRedact is used to format payload of messages, see SetPayloadRedactor
+var payloadRedact PayloadRedactFnc = redactPayload
+
+// SetPayloadRedactor replaces the function formatting payload of messages in errors and logs.
+// By default, only size of payload is shown.
+// It is not goroutine safe, so should be called before any client or server starts.
+func SetPayloadRedactor(fnc PayloadRedactFnc) {
+	if fnc == nil {
+		fnc = redactPayload
+	}
+	payloadRedact = fnc
+}
+
+func redactPayload(payload []byte) string {
+	return fmt.Sprintf("[%d bytes]", len(payload))
+}
+
+// redactSecret returns redacted for non empty secret
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+type queueConf QueueConf
+
+// Format formats QueueConf with its secrets redacted
+func (c QueueConf) Format(f fmt.State, verb rune) {
+	c.AWSSecretAccessKey = redactSecret(c.AWSSecretAccessKey)
+	c.SessionToken = redactSecret(c.SessionToken)
+	formatRedacted(f, verb, queueConf(c))
+}
+
+type s3BlobStoreConf S3BlobStoreConf
+
+// Format formats S3BlobStoreConf with its secrets redacted
+func (c S3BlobStoreConf) Format(f fmt.State, verb rune) {
+	c.AWSSecretAccessKey = redactSecret(c.AWSSecretAccessKey)
+	c.SessionToken = redactSecret(c.SessionToken)
+	formatRedacted(f, verb, s3BlobStoreConf(c))
+}
+
+type topicConf TopicConf
+
+// Format formats TopicConf with its secrets redacted
+func (c TopicConf) Format(f fmt.State, verb rune) {
+	c.AWSSecretAccessKey = redactSecret(c.AWSSecretAccessKey)
+	c.SessionToken = redactSecret(c.SessionToken)
+	formatRedacted(f, verb, topicConf(c))
+}
+
+// rpcMessage is the redacted form of RPCMessage
+type rpcMessage struct {
+	ID           string
+	SvrName      ServiceName
+	MthName      MethodName
+	Payload      string
+	PayloadRef   string
+	Compression  string
+	Encrypted    bool
+	MetadataKeys []string
+	GroupID      string
+	DedupID      string
+	Attempt      int
+}
+
+// Format formats RPCMessage with its payload redacted by payload redactor,
+// and without signature, encryption info and metadata values, for any verb
+func (msg RPCMessage) Format(f fmt.State, verb rune) {
+	metadataKeys := make([]string, 0, len(msg.Metadata))
+	for k := range msg.Metadata {
+		metadataKeys = append(metadataKeys, k)
+	}
+	sort.Strings(metadataKeys)
+
+	formatRedacted(f, verb, rpcMessage{
+		ID:           msg.ID,
+		SvrName:      msg.SvrName,
+		MthName:      msg.MthName,
+		Payload:      payloadRedact(msg.Payload),
+		PayloadRef:   msg.PayloadRef,
+		Compression:  msg.Compression,
+		Encrypted:    msg.Encryption != nil,
+		MetadataKeys: metadataKeys,
+		GroupID:      msg.GroupID,
+		DedupID:      msg.DedupID,
+		Attempt:      msg.attempt,
+	})
+}
+
+// formatRedacted formats v by given verb and flags of f
+func formatRedacted(f fmt.State, verb rune, v interface{}) {
+	format := "%"
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			format += string(flag)
+		}
+	}
+	fmt.Fprintf(f, format+string(verb), v)
+}
@@ -0,0 +1,95 @@
+package myrpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testSecretKey    = "secret-access-key-value"
+	testSessionToken = "session-token-value"
+	testPayload      = "payload-value"
+	testMetadata     = "metadata-value"
+)
+
+var redactVerbs = []string{"%v", "%+v", "%s", "%#v", "%q", "%x"}
+
+func assertRedacted(t *testing.T, formatted string) {
+	t.Helper()
+	for _, secret := range []string{testSecretKey, testSessionToken, testPayload, testMetadata} {
+		for _, form := range []string{secret, fmt.Sprintf("%x", secret)} {
+			if strings.Contains(formatted, form) {
+				t.Errorf("secret %q is in %q", secret, formatted)
+			}
+		}
+	}
+}
+
+func TestFormatRedacted(t *testing.T) {
+	role := AWSRoleConf{Profile: "missing"}
+	values := map[string]interface{}{
+		"QueueConf": QueueConf{QueueName: "queue", AWSAccessKeyID: "key", AWSSecretAccessKey: testSecretKey,
+			SessionToken: testSessionToken, AWSRoleConf: role},
+		"S3BlobStoreConf": S3BlobStoreConf{Bucket: "bucket", AWSAccessKeyID: "key", AWSSecretAccessKey: testSecretKey,
+			SessionToken: testSessionToken, AWSRoleConf: role},
+		"TopicConf": TopicConf{TopicARN: "arn", AWSAccessKeyID: "key", AWSSecretAccessKey: testSecretKey,
+			SessionToken: testSessionToken, AWSRoleConf: role},
+		"RPCMessage": &RPCMessage{ID: "id", SvrName: "svc", MthName: "mth", Payload: []byte(testPayload),
+			Metadata: map[string]string{"key": testMetadata}},
+	}
+	for name, v := range values {
+		for _, verb := range redactVerbs {
+			t.Run(name+verb, func(t *testing.T) {
+				formatted := fmt.Sprintf(verb, v)
+				assertRedacted(t, formatted)
+				if verb != "%x" && !strings.Contains(formatted, redacted) && !strings.Contains(formatted, "13 bytes") {
+					t.Errorf("redacted form is not in %q", formatted)
+				}
+			})
+		}
+	}
+}
+
+func TestConstructorErrorRedacted(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	configFile, credentialsFile := filepath.Join(dir, "config"), filepath.Join(dir, "credentials")
+	writeFile(t, configFile, "[profile broken]\nrole_arn = arn:aws:iam::123456789012:role/broken\ncredential_source = Bogus\n")
+	writeFile(t, credentialsFile, "")
+	defer isolateAWSEnv(t, configFile, credentialsFile)()
+
+	ctx := context.Background()
+	// without access key id, secrets are not used but kept in conf,
+	// and invalid profile of shared config fails the session of constructors
+	role := AWSRoleConf{Profile: "broken"}
+	queue := QueueConf{QueueRegion: "us-east-1", QueueName: "queue",
+		AWSSecretAccessKey: testSecretKey, SessionToken: testSessionToken, AWSRoleConf: role}
+	_, senderErr := NewSQSSender(ctx, SenderConf{Queue: queue})
+	_, replyErr := NewSQSReplySender(ctx, queue)
+	_, receiverErr := NewSQSReceiver(ctx, ReceiverConf{Queue: queue})
+	_, blobErr := NewS3BlobStore(ctx, S3BlobStoreConf{Region: "us-east-1", Bucket: "bucket",
+		AWSSecretAccessKey: testSecretKey, SessionToken: testSessionToken, AWSRoleConf: role})
+	_, publisherErr := NewSNSPublisher(ctx, map[string]TopicConf{"topic": {Region: "us-east-1", TopicARN: "arn",
+		AWSSecretAccessKey: testSecretKey, SessionToken: testSessionToken, AWSRoleConf: role}})
+
+	errs := map[string]error{
+		"NewSQSSender":      senderErr,
+		"NewSQSReplySender": replyErr,
+		"NewSQSReceiver":    receiverErr,
+		"NewS3BlobStore":    blobErr,
+		"NewSNSPublisher":   publisherErr,
+	}
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s returns no error", name)
+			continue
+		}
+		for _, verb := range redactVerbs {
+			assertRedacted(t, fmt.Sprintf(verb, err))
+		}
+	}
+}
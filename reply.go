@@ -0,0 +1,168 @@
+package myrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReplyTimeout is the time client waits for reply of a request, see RPCClient.SetReplyTimeout
+const DefaultReplyTimeout = 30 * time.Second
+
+// replyRetryWait is the time reply listener waits after failing to receive replies
+const replyRetryWait = time.Second
+
+// ErrNoReply is the cause of error of request that is not replied in time, or is canceled
+var ErrNoReply = errors.New("no reply")
+
+// RemoteError is the error returned by handler of request on server
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// ReplySender is the interface to send reply to the queue that request asks for, by its ReplyTo
+type ReplySender interface {
+	SendReply(replyTo string, msg *RPCMessage) error
+}
+
+// ReplyQueues sends replies to senders by name of reply queue, such as MemoryQueue in tests
+type ReplyQueues map[string]MessageSender
+
+// SendReply sends reply by sender of given reply queue
+func (rq ReplyQueues) SendReply(replyTo string, msg *RPCMessage) error {
+	sender, ok := rq[replyTo]
+	if !ok {
+		return errors.Errorf("unknown reply queue %s", replyTo)
+	}
+
+	return sender.SendAsyncMsg(msg)
+}
+
+// replyListener receives replies from reply queue of client by a single loop,
+// and passes each reply to the request waiting for it
+type replyListener struct {
+	client   *RPCClient
+	replyTo  string
+	receiver MessageReceiver
+	deleter  MessageDeleter
+	locker   sync.Mutex
+	// deliver funcs of requests waiting for their replies, by message id
+	pending map[string]func(reply *RPCMessage)
+}
+
+// register makes reply of request of given id be passed to given deliver func.
+// The func must not block, as it is called by the listener loop.
+func (rl *replyListener) register(id string, deliver func(reply *RPCMessage)) {
+	rl.locker.Lock()
+	rl.pending[id] = deliver
+	rl.locker.Unlock()
+}
+
+// unregister stops waiting for reply of request of given id, so its late reply is discarded
+func (rl *replyListener) unregister(id string) {
+	rl.locker.Lock()
+	delete(rl.pending, id)
+	rl.locker.Unlock()
+}
+
+// listen receives replies until ctx is done
+func (rl *replyListener) listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		msgs, err := rl.receiver.ReceiveMsg()
+		if err != nil {
+			rl.client.logger.Error("cannot receive replies", Field{Key: FieldReplyTo, Value: rl.replyTo}, errField(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(replyRetryWait):
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			rl.deliver(msg)
+			if rl.deleter == nil {
+				continue
+			}
+			if err := rl.deleter.DeleteMsg(msg); err != nil {
+				rl.client.logger.Error("cannot delete reply", msgFields(msg, errField(err))...)
+			}
+		}
+	}
+}
+
+// deliver passes reply to the request waiting for it, or discards it if no request is waiting
+func (rl *replyListener) deliver(msg *RPCMessage) {
+	rl.locker.Lock()
+	deliver, ok := rl.pending[msg.CorrelationID]
+	delete(rl.pending, msg.CorrelationID)
+	rl.locker.Unlock()
+
+	if !ok {
+		rl.client.logger.Debug("discard late reply", msgFields(msg, Field{Key: FieldCorrelationID, Value: msg.CorrelationID})...)
+		return
+	}
+	deliver(msg)
+}
+
+// sendRequest sends request that asks for reply to reply queue of client,
+// and makes its reply be passed to given deliver func. It returns id of the request.
+func (c *RPCClient) sendRequest(ctx context.Context, svr ServiceName, mth MethodName, in interface{}, encodeFnc PayloadEncodeFnc, opts []CallOption, deliver func(reply *RPCMessage)) (string, error) {
+	ctx, span := c.tracer.StartProducer(ctx, svr, mth)
+	opts = append(append([]CallOption{}, opts...), withReplyTo(c.replies.replyTo))
+	rpcMsg, err := c.newRPCMsg(ctx, svr, mth, in, encodeFnc, opts)
+	if err != nil {
+		span.End(err)
+		return "", err
+	}
+	if rpcMsg.DeliverAt != 0 {
+		err := errors.New("delayed delivery is not supported on synchronous call")
+		span.End(err)
+		c.discardBlob(rpcMsg)
+		return "", err
+	}
+
+	// register first, so a fast reply is not discarded
+	c.replies.register(rpcMsg.ID, deliver)
+	start := time.Now()
+	err = sendMsgContext(ctx, c.sender, rpcMsg)
+	c.observeSent(rpcMsg, start, err)
+	span.End(err)
+	if err != nil {
+		c.replies.unregister(rpcMsg.ID)
+		c.discardBlob(rpcMsg)
+		return "", err
+	}
+
+	return rpcMsg.ID, nil
+}
+
+// decodeReply verifies reply, then returns its error if it is a failure, or decrypts and decodes its payload to out
+func (c *RPCClient) decodeReply(reply *RPCMessage, out interface{}) error {
+	if c.verifier != nil {
+		// reply is matched to its waiting request, so replay window does not apply
+		if err := verifyMsg(reply, c.verifier, 0); err != nil {
+			return errors.Wrapf(err, "cannot verify reply of msg %s", reply.CorrelationID)
+		}
+	}
+	if reply.ReplyError != "" {
+		return &RemoteError{Message: reply.ReplyError}
+	}
+	if out == nil || len(reply.Payload) == 0 {
+		return nil
+	}
+	payload, err := decryptPayload(reply, reply.Payload, c.keyProvider)
+	if err != nil {
+		return errors.Wrapf(err, "cannot decrypt reply of msg %s", reply.CorrelationID)
+	}
+	if err := c.replyDecode(payload, out); err != nil {
+		return errors.Wrapf(err, "cannot decode reply payload %s", payloadRedact(payload))
+	}
+
+	return nil
+}
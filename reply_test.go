@@ -0,0 +1,90 @@
+package myrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type echoIn struct {
+	N int
+}
+
+// serveDouble serves method "svc"/"double" on given server, and returns the number of its calls
+func serveDouble(srv *RPCServer) *int32 {
+	var calls int32
+	srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+		"double": {Name: "double", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return in.(*echoIn).N * 2, nil
+		}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+			var in echoIn
+			return &in, dec(data, &in)
+		}},
+	}})
+	go srv.Serve()
+
+	return &calls
+}
+
+func TestSecureReply(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "keys.yaml")
+	writeFile(t, keyFile, "current_key_id: k1\nkeys:\n  k1: "+base64.StdEncoding.EncodeToString(make([]byte, dataKeySize))+"\n")
+	kp, err := NewFileKeyProvider(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		kp       KeyProvider
+		verifier Verifier
+		wantErr  string
+	}{
+		{name: "verified and decrypted", kp: kp, verifier: NewHMACVerifier(map[string][]byte{"srv": []byte("server-key")})},
+		{name: "unknown signing key", kp: kp, verifier: NewHMACVerifier(map[string][]byte{"other": []byte("server-key")}),
+			wantErr: "cannot verify reply"},
+		{name: "no key provider", verifier: NewHMACVerifier(map[string][]byte{"srv": []byte("server-key")}),
+			wantErr: "cannot decrypt reply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			q, rq := NewMemoryQueue(), NewMemoryQueue()
+			srv := NewRPCServer(ctx, q, q)
+			srv.SetReplySender(ReplyQueues{"replies": rq})
+			srv.UseKeyProvider(kp)
+			srv.UseSigner(NewHMACSigner("srv", []byte("server-key")))
+			serveDouble(srv)
+
+			c := NewRPCClient(ctx, q)
+			if tt.kp != nil {
+				c.UseEncryption(tt.kp)
+			}
+			c.UseReplyQueue("replies", rq, rq)
+			c.UseVerifier(tt.verifier)
+
+			var out int
+			err := c.SendSyncMsg("svc", "double", &echoIn{N: 21}, &out, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error is %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != 42 {
+				t.Errorf("reply is %d, want 42", out)
+			}
+		})
+	}
+}
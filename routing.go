@@ -0,0 +1,173 @@
+package myrpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RoutingSender sends messages to different senders by their service and method,
+// so services or methods could be moved to their own queues.
+// Route of method takes precedence over route of its service,
+// and messages without route are sent by the default sender.
+type RoutingSender struct {
+	locker        sync.RWMutex
+	defaultSender MessageSender
+	routes        map[string]MessageSender
+}
+
+// NewRoutingSender returns routing sender that sends messages without route by given default sender.
+// Default sender could be nil, then messages without route are rejected.
+func NewRoutingSender(defaultSender MessageSender) *RoutingSender {
+	return &RoutingSender{
+		defaultSender: defaultSender,
+		routes:        make(map[string]MessageSender),
+	}
+}
+
+// Route sends messages of given service and method by given sender.
+// Empty method routes all methods of the service.
+func (rs *RoutingSender) Route(svr ServiceName, mth MethodName, sender MessageSender) {
+	rs.locker.Lock()
+	rs.routes[routeKey(svr, mth)] = sender
+	rs.locker.Unlock()
+}
+
+// ParseRoute parses route in format "Service" or "Service/Method"
+func ParseRoute(route string) (ServiceName, MethodName) {
+	parts := strings.SplitN(route, "/", 2)
+	if len(parts) == 1 {
+		return ServiceName(parts[0]), ""
+	}
+
+	return ServiceName(parts[0]), MethodName(parts[1])
+}
+
+// SenderOf returns sender of messages of given service and method
+func (rs *RoutingSender) SenderOf(svr ServiceName, mth MethodName) (MessageSender, error) {
+	rs.locker.RLock()
+	defer rs.locker.RUnlock()
+
+	if sender, ok := rs.routes[routeKey(svr, mth)]; ok {
+		return sender, nil
+	}
+	if sender, ok := rs.routes[routeKey(svr, "")]; ok {
+		return sender, nil
+	}
+	if rs.defaultSender == nil {
+		return nil, errors.Errorf("no route for %s/%s", svr, mth)
+	}
+
+	return rs.defaultSender, nil
+}
+
+// SendAsyncMsg sends message by sender of its route
+func (rs *RoutingSender) SendAsyncMsg(msg *RPCMessage) error {
+	return dispatchSender{rs}.SendAsyncMsg(msg)
+}
+
+// SendAsyncMsgContext sends message by sender of its route within given ctx, if that sender supports it
+func (rs *RoutingSender) SendAsyncMsgContext(ctx context.Context, msg *RPCMessage) error {
+	return dispatchSender{rs}.SendAsyncMsgContext(ctx, msg)
+}
+
+// SendSyncMsg sends message by sender of its route, and waits for response
+func (rs *RoutingSender) SendSyncMsg(msg *RPCMessage, out interface{}) error {
+	return dispatchSender{rs}.SendSyncMsg(msg, out)
+}
+
+// SendDelayedMsg sends message by sender of its route, with delay capped at maximum delay of that sender
+func (rs *RoutingSender) SendDelayedMsg(msg *RPCMessage, delay time.Duration) error {
+	return dispatchSender{rs}.SendDelayedMsg(msg, delay)
+}
+
+// MaxDelay returns the longest maximum delay of all senders.
+// Delay is capped again by sender of each message.
+func (rs *RoutingSender) MaxDelay() time.Duration {
+	return dispatchSender{rs}.MaxDelay()
+}
+
+func (rs *RoutingSender) senderOfMsg(msg *RPCMessage) (MessageSender, error) {
+	return rs.SenderOf(msg.SvrName, msg.MthName)
+}
+
+func (rs *RoutingSender) allSenders() []MessageSender {
+	rs.locker.RLock()
+	defer rs.locker.RUnlock()
+
+	senders := []MessageSender{rs.defaultSender}
+	for _, sender := range rs.routes {
+		senders = append(senders, sender)
+	}
+
+	return senders
+}
+
+func routeKey(svr ServiceName, mth MethodName) string {
+	if mth == "" {
+		return string(svr)
+	}
+
+	return string(svr) + "/" + string(mth)
+}
+
+// dispatcher selects sender of each message among its senders
+type dispatcher interface {
+	senderOfMsg(msg *RPCMessage) (MessageSender, error)
+	allSenders() []MessageSender
+}
+
+// dispatchSender sends each message by sender selected by dispatcher
+type dispatchSender struct {
+	dispatcher
+}
+
+func (ds dispatchSender) SendAsyncMsg(msg *RPCMessage) error {
+	sender, err := ds.senderOfMsg(msg)
+	if err != nil {
+		return err
+	}
+
+	return sender.SendAsyncMsg(msg)
+}
+
+func (ds dispatchSender) SendAsyncMsgContext(ctx context.Context, msg *RPCMessage) error {
+	sender, err := ds.senderOfMsg(msg)
+	if err != nil {
+		return err
+	}
+
+	return sendMsgContext(ctx, sender, msg)
+}
+
+func (ds dispatchSender) SendSyncMsg(msg *RPCMessage, out interface{}) error {
+	sender, err := ds.senderOfMsg(msg)
+	if err != nil {
+		return err
+	}
+
+	return sender.SendSyncMsg(msg, out)
+}
+
+func (ds dispatchSender) SendDelayedMsg(msg *RPCMessage, delay time.Duration) error {
+	sender, err := ds.senderOfMsg(msg)
+	if err != nil {
+		return err
+	}
+
+	return sendMsgWithDelay(sender, msg, delay)
+}
+
+func (ds dispatchSender) MaxDelay() time.Duration {
+	var maxDelay time.Duration
+	for _, sender := range ds.allSenders() {
+		if delayed, ok := sender.(DelayedMessageSender); ok && delayed.MaxDelay() > maxDelay {
+			maxDelay = delayed.MaxDelay()
+		}
+	}
+
+	return maxDelay
+}
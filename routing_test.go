@@ -0,0 +1,121 @@
+package myrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		route string
+		svr   ServiceName
+		mth   MethodName
+	}{
+		{"Echo", "Echo", ""},
+		{"Echo/Hello", "Echo", "Hello"},
+		{"Echo/", "Echo", ""},
+		{"/Hello", "", "Hello"},
+		{"Echo/Hello/World", "Echo", "Hello/World"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			if svr, mth := ParseRoute(tt.route); svr != tt.svr || mth != tt.mth {
+				t.Errorf("ParseRoute(%q) = %q, %q, want %q, %q", tt.route, svr, mth, tt.svr, tt.mth)
+			}
+		})
+	}
+}
+
+func TestRoutingSenderOf(t *testing.T) {
+	defaultSender, echo, hello := &recordingSender{}, &recordingSender{}, &recordingSender{}
+	senders := map[string]MessageSender{"default": defaultSender, "echo": echo, "hello": hello}
+	tests := []struct {
+		name    string
+		dflt    MessageSender
+		svr     ServiceName
+		mth     MethodName
+		want    string
+		wantErr bool
+	}{
+		{name: "route of method", dflt: defaultSender, svr: "Echo", mth: "Hello", want: "hello"},
+		{name: "route of service", dflt: defaultSender, svr: "Echo", mth: "Bye", want: "echo"},
+		{name: "route of method without route of service", dflt: defaultSender, svr: "Greeter", mth: "Hello", want: "hello"},
+		{name: "other method without route of service", dflt: defaultSender, svr: "Greeter", mth: "Bye", want: "default"},
+		{name: "default route", dflt: defaultSender, svr: "Other", mth: "Hello", want: "default"},
+		{name: "route without default", svr: "Echo", mth: "Hello", want: "hello"},
+		{name: "unknown route without default", svr: "Other", mth: "Hello", wantErr: true},
+		{name: "method of other service without default", svr: "Greeter", mth: "Bye", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := NewRoutingSender(tt.dflt)
+			rs.Route("Echo", "", echo)
+			rs.Route("Echo", "Hello", hello)
+			rs.Route("Greeter", "Hello", hello)
+
+			sender, err := rs.SenderOf(tt.svr, tt.mth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SenderOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && sender != senders[tt.want] {
+				t.Errorf("SenderOf() is not sender %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingSenderSend(t *testing.T) {
+	defaultSender, echo := &recordingSender{}, &recordingSender{}
+	rs := NewRoutingSender(defaultSender)
+	rs.Route("Echo", "", echo)
+
+	msgs := []*RPCMessage{{ID: "1", SvrName: "Echo", MthName: "Hello"}, {ID: "2", SvrName: "Other", MthName: "Hello"}}
+	if err := rs.SendAsyncMsg(msgs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.SendAsyncMsgContext(context.Background(), msgs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.SendDelayedMsg(msgs[0], time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(echo.msgs) != 2 || echo.msgs[0].ID != "1" || len(defaultSender.msgs) != 1 || defaultSender.msgs[0].ID != "2" {
+		t.Errorf("sent to route %d, to default %d messages", len(echo.msgs), len(defaultSender.msgs))
+	}
+
+	strict := NewRoutingSender(nil)
+	strict.Route("Echo", "", echo)
+	if err := strict.SendAsyncMsg(msgs[1]); err == nil {
+		t.Error("message of unknown route is sent without default sender")
+	}
+	if got := strict.MaxDelay(); got != echo.MaxDelay() {
+		t.Errorf("MaxDelay() = %s, want %s", got, echo.MaxDelay())
+	}
+}
+
+func TestRoutingSenderFromConf(t *testing.T) {
+	defaultSender, main, other := &recordingSender{}, &recordingSender{}, &recordingSender{}
+	conf := &Config{Client: ClientConf{Routes: map[string]string{"Echo": "main", "Echo/Hello": "other"}}}
+	senders := &queueSenders{conf: conf, senders: map[string]MessageSender{"main": main, "other": other}}
+
+	rs, err := routingSenderFromConf(conf, senders, defaultSender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		svr  ServiceName
+		mth  MethodName
+		want MessageSender
+	}{
+		{"Echo", "Hello", other},
+		{"Echo", "Bye", main},
+		{"Other", "Hello", defaultSender},
+	}
+	for _, tt := range tests {
+		if sender, err := rs.SenderOf(tt.svr, tt.mth); err != nil || sender != tt.want {
+			t.Errorf("SenderOf(%s, %s) = %v, %v", tt.svr, tt.mth, sender, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package myrpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+type s3BlobStore struct {
+	ctx  context.Context
+	s3   *s3.S3
+	conf S3BlobStoreConf
+}
+
+// NewS3BlobStore returns a blob store that keeps blobs in S3 or S3 compatible storage, such as MinIO
+func NewS3BlobStore(ctx context.Context, conf S3BlobStoreConf) (BlobStore, error) {
+	if conf.Bucket == "" {
+		return nil, errors.New("bucket is required for s3 blob store")
+	}
+
+	s3Session, err := newAWSSession(conf.Region, conf.AWSAccessKeyID, conf.AWSSecretAccessKey, conf.SessionToken, conf.AWSRoleConf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot init s3 session for bucket %s", conf.Bucket)
+	}
+
+	return &s3BlobStore{
+		ctx: ctx,
+		s3: s3.New(s3Session, &aws.Config{
+			Endpoint:         aws.String(conf.Endpoint),
+			S3ForcePathStyle: aws.Bool(conf.ForcePathStyle),
+		}),
+		conf: conf,
+	}, nil
+}
+
+func (bs *s3BlobStore) PutBlob(key string, data []byte) error {
+	objectKey, err := bs.objectKey(key)
+	if err != nil {
+		return err
+	}
+	param := &s3.PutObjectInput{
+		Bucket: aws.String(bs.conf.Bucket),
+		Key:    aws.String(objectKey),
+		Body:   bytes.NewReader(data),
+	}
+	if _, err := bs.s3.PutObjectWithContext(bs.ctx, param); err != nil {
+		return errors.Wrapf(err, "cannot put blob %s to bucket %s", key, bs.conf.Bucket)
+	}
+
+	return nil
+}
+
+func (bs *s3BlobStore) GetBlob(key string) ([]byte, error) {
+	objectKey, err := bs.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	param := &s3.GetObjectInput{
+		Bucket: aws.String(bs.conf.Bucket),
+		Key:    aws.String(objectKey),
+	}
+	resp, err := bs.s3.GetObjectWithContext(bs.ctx, param)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get blob %s from bucket %s", key, bs.conf.Bucket)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read blob %s from bucket %s", key, bs.conf.Bucket)
+	}
+
+	return data, nil
+}
+
+func (bs *s3BlobStore) DeleteBlob(key string) error {
+	objectKey, err := bs.objectKey(key)
+	if err != nil {
+		return err
+	}
+	param := &s3.DeleteObjectInput{
+		Bucket: aws.String(bs.conf.Bucket),
+		Key:    aws.String(objectKey),
+	}
+	if _, err := bs.s3.DeleteObjectWithContext(bs.ctx, param); err != nil {
+		return errors.Wrapf(err, "cannot delete blob %s from bucket %s", key, bs.conf.Bucket)
+	}
+
+	return nil
+}
+
+// objectKey returns key of object of given blob key under key prefix, keys must not escape the prefix
+func (bs *s3BlobStore) objectKey(key string) (string, error) {
+	if err := validateBlobKey(key); err != nil {
+		return "", err
+	}
+
+	return path.Join(bs.conf.KeyPrefix, key), nil
+}
@@ -0,0 +1,134 @@
+package myrpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Target is one request of ScatterGather, such as a service or a shard of it
+type Target struct {
+	SvrName ServiceName
+	MthName MethodName
+	In      interface{}
+	// Out is decoded from reply of target, could be nil
+	Out interface{}
+	// Opts are call options of this request, such as WithMetadata to select a shard
+	Opts []CallOption
+}
+
+// GatherResult is the result of ScatterGather.
+// Out of a target is valid only if its error is nil.
+type GatherResult struct {
+	// Errs are errors of targets by their index, nil if target replied successfully.
+	// Targets that are not replied in time, or are given up on quorum or cancellation, have ErrNoReply as cause.
+	Errs []error
+	// Replied is number of targets that replied successfully
+	Replied int
+}
+
+// GatherOption configures a ScatterGather call
+type GatherOption func(*gatherOptions)
+
+type gatherOptions struct {
+	quorum  int
+	timeout time.Duration
+}
+
+// WithQuorum returns as soon as given number of targets replied successfully,
+// instead of waiting for all targets
+func WithQuorum(n int) GatherOption {
+	return func(o *gatherOptions) {
+		o.quorum = n
+	}
+}
+
+// WithGatherTimeout waits for replies until given timeout, instead of reply timeout of client
+func WithGatherTimeout(timeout time.Duration) GatherOption {
+	return func(o *gatherOptions) {
+		o.timeout = timeout
+	}
+}
+
+// ScatterGather sends one request to each target and gathers their replies from reply queue of client.
+// It returns when all targets replied, when quorum is reached, when timeout passes or when ctx is done,
+// with partial results and error of each target. Late replies are discarded.
+// Error is returned, along with the result, if number of successful replies is less than quorum
+// (all targets by default). Deadline of ctx is sent as deadline of requests.
+func (c *RPCClient) ScatterGather(ctx context.Context, targets []Target, opts ...GatherOption) (*GatherResult, error) {
+	if c.replies == nil {
+		return nil, errors.New("no reply queue of client, see UseReplyQueue")
+	}
+
+	o := &gatherOptions{quorum: len(targets), timeout: c.replyTimeout}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.quorum <= 0 || o.quorum > len(targets) {
+		return nil, errors.Errorf("quorum must be between 1 and %d, got %d", len(targets), o.quorum)
+	}
+
+	result := &GatherResult{Errs: make([]error, len(targets))}
+	replies := make(chan *RPCMessage, len(targets))
+	// index of targets waiting for reply, by request id
+	waiting := make(map[string]int, len(targets))
+	defer func() {
+		for id := range waiting {
+			c.replies.unregister(id)
+		}
+	}()
+
+	failed := 0
+	for i, t := range targets {
+		id, err := c.sendRequest(ctx, t.SvrName, t.MthName, t.In, nil, t.Opts, func(reply *RPCMessage) {
+			// buffered for all targets, never blocks
+			replies <- reply
+		})
+		if err != nil {
+			result.Errs[i] = err
+			failed++
+			continue
+		}
+		waiting[id] = i
+	}
+
+	timer := time.NewTimer(o.timeout)
+	defer timer.Stop()
+	// stop once quorum is reached, or could not be reached anymore
+	for len(waiting) > 0 && result.Replied < o.quorum && len(targets)-failed >= o.quorum {
+		select {
+		case reply := <-replies:
+			i, ok := waiting[reply.CorrelationID]
+			if !ok {
+				continue
+			}
+			delete(waiting, reply.CorrelationID)
+			if err := c.decodeReply(reply, targets[i].Out); err != nil {
+				result.Errs[i] = err
+				failed++
+				continue
+			}
+			result.Replied++
+		case <-timer.C:
+			return result, gatherErr(result, waiting, o.quorum, errors.Wrapf(ErrNoReply, "not replied in %s", o.timeout))
+		case <-ctx.Done():
+			return result, gatherErr(result, waiting, o.quorum, errors.Wrap(ErrNoReply, ctx.Err().Error()))
+		}
+	}
+
+	return result, gatherErr(result, waiting, o.quorum, errors.Wrap(ErrNoReply, "given up"))
+}
+
+// gatherErr sets given error to targets still waiting for reply,
+// and returns error if quorum is not reached
+func gatherErr(result *GatherResult, waiting map[string]int, quorum int, noReply error) error {
+	for _, i := range waiting {
+		result.Errs[i] = noReply
+	}
+	if result.Replied < quorum {
+		return errors.Errorf("%d of %d targets replied, quorum is %d", result.Replied, len(result.Errs), quorum)
+	}
+
+	return nil
+}
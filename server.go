@@ -1,13 +1,19 @@
 package myrpc
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -28,6 +34,9 @@ type MethodDescription struct {
 	Handler       MethodHandler
 	PayloadDecode PayloadDecodeFnc
 	DecodeHandle  MethodDecodeFnc
+	// TTL is the default time to live of messages of method, from their delivery time.
+	// Deadline of message takes precedence if it is earlier.
+	TTL time.Duration
 }
 
 // ServiceName is a key for map of services in a RPC server
@@ -55,29 +64,78 @@ type MessageDeleter interface {
 	DeleteMsg(msg *RPCMessage) error
 }
 
+// metricsRecorder is the interface of receiver that records metrics
+type metricsRecorder interface {
+	SetMetrics(metrics Metrics)
+}
+
+// ExpiredAction is what server does with message that expired in queue before it is handled
+type ExpiredAction string
+
+// Expired actions
+const (
+	// ExpiredDrop deletes expired message without handling it. It is the default.
+	ExpiredDrop ExpiredAction = "drop"
+	// ExpiredDeadLetter sends expired message to dead letter queue, see SetDeadLetterSender
+	ExpiredDeadLetter ExpiredAction = "dead_letter"
+)
+
 // RPCServer is struct of this RPC server
 type RPCServer struct {
 	ctx           context.Context
 	locker        sync.Mutex
 	servicesDesc  map[ServiceName]ServiceDescription
 	services      map[ServiceName]interface{}
-	msgReceiver   MessageReceiver
-	msgDeleter    MessageDeleter
+	topics        map[string]topicHandler
+	queues        []*serverQueue
+	requeueSender MessageSender
+	replySender   ReplySender
+	replyEncode   PayloadEncodeFnc
+	expiredAction ExpiredAction
+	dedupStore    DedupStore
+	inbox         *SQLInbox
+	blobStore     BlobStore
+	keyProvider   KeyProvider
+	signer        Signer
+	verifier      Verifier
+	replayWindow  time.Duration
+	deadLetter    MessageSender
+	logger        Logger
+	metrics       Metrics
+	tracer        Tracer
+	authorizer    Authorizer
+	authzAudit    AuthzAuditFnc
+	keyIdentities map[string]Identity
 	payloadDecode PayloadDecodeFnc
 	exitChan      chan os.Signal
+	stats         serverStats
+	workers       chan struct{}
+	maxAttempts   int
+	adminServer   *http.Server
 }
 
-// NewRPCServer return new RPC server
+// NewRPCServer return new RPC server that receives messages from queue DefaultQueueName
+// by given receiver. More queues could be added by AddQueue,
+// or receiver could be nil for server that receives from added queues only.
 func NewRPCServer(ctx context.Context, mr MessageReceiver, md MessageDeleter) *RPCServer {
-	return &RPCServer{
+	srv := &RPCServer{
 		ctx:           ctx,
-		msgReceiver:   mr,
-		msgDeleter:    md,
 		servicesDesc:  make(map[ServiceName]ServiceDescription),
 		services:      make(map[ServiceName]interface{}),
+		topics:        make(map[string]topicHandler),
 		payloadDecode: json.Unmarshal, // default
+		replyEncode:   json.Marshal,
+		expiredAction: ExpiredDrop,
+		logger:        NopLogger(),
+		metrics:       NopMetrics{},
+		tracer:        NopTracer(),
 		exitChan:      make(chan os.Signal, 1),
 	}
+	if mr != nil {
+		srv.AddQueue(DefaultQueueName, mr, md)
+	}
+
+	return srv
 }
 
 // ReplacePayloadDecoder replaces payload decode function of rpc server
@@ -87,6 +145,163 @@ func (srv *RPCServer) ReplaceDecoder(decFnc PayloadDecodeFnc) {
 	srv.locker.Unlock()
 }
 
+// SetConcurrency limits number of workers that handle messages concurrently.
+// Each worker handles a group of messages. Non-positive n means unlimited.
+// Workers are split among queues by their weights, see AddQueue.
+// This should be called before Serve method
+func (srv *RPCServer) SetConcurrency(n int) {
+	srv.locker.Lock()
+	srv.workers = nil
+	if n > 0 {
+		srv.workers = make(chan struct{}, n)
+	}
+	srv.locker.Unlock()
+}
+
+// SetRetryPolicy makes server keep serving when a message fails.
+// Failed message is retried after its visibility timeout,
+// and is dead-lettered after maxAttempts attempts, as reported by receiver (see RPCMessage.Attempt).
+// Non-positive maxAttempts means server stops on the first failed message.
+func (srv *RPCServer) SetRetryPolicy(maxAttempts int) {
+	srv.locker.Lock()
+	srv.maxAttempts = maxAttempts
+	srv.locker.Unlock()
+}
+
+// SetLogger replaces logger of rpc server
+func (srv *RPCServer) SetLogger(logger Logger) {
+	srv.locker.Lock()
+	srv.logger = logger
+	srv.locker.Unlock()
+}
+
+// SetMetrics replaces metrics of rpc server.
+// Receivers that record metrics, such as PriorityReceiver, get the same metrics on Serve.
+func (srv *RPCServer) SetMetrics(metrics Metrics) {
+	srv.locker.Lock()
+	srv.metrics = metrics
+	srv.locker.Unlock()
+}
+
+// SetTracer replaces tracer of rpc server
+func (srv *RPCServer) SetTracer(tracer Tracer) {
+	srv.locker.Lock()
+	srv.tracer = tracer
+	srv.locker.Unlock()
+}
+
+// SetRequeueSender sets sender that is used to re-enqueue delayed messages
+// which arrive before their delivery time.
+// The sender should send messages to the queue that server receives from,
+// and should implement DelayedMessageSender.
+// It is used for queues without their own requeue sender, see WithQueueRequeueSender.
+func (srv *RPCServer) SetRequeueSender(sender MessageSender) {
+	srv.locker.Lock()
+	srv.requeueSender = sender
+	srv.locker.Unlock()
+}
+
+// SetReplySender sets sender of replies to requests that ask for reply, see RPCClient.UseReplyQueue.
+// Request is replied with result of its handler, or with error if it is dead-lettered or unauthorized.
+func (srv *RPCServer) SetReplySender(sender ReplySender) {
+	srv.locker.Lock()
+	srv.replySender = sender
+	srv.locker.Unlock()
+}
+
+// SetExpiredAction sets what server does with message that expired before it is handled, see RPCMessage.Deadline
+func (srv *RPCServer) SetExpiredAction(action ExpiredAction) {
+	srv.locker.Lock()
+	srv.expiredAction = action
+	srv.locker.Unlock()
+}
+
+// UseDedupStore makes server skip messages that are already handled, by their ID recorded in given store.
+// Duplicate of a request is replied with the cached result. Duplicates delivered concurrently
+// could still be handled twice, see inbox for exactly-once effects.
+func (srv *RPCServer) UseDedupStore(store DedupStore) {
+	srv.locker.Lock()
+	srv.dedupStore = store
+	srv.locker.Unlock()
+}
+
+// UseInbox makes handlers run in a transaction of given inbox, see TxFromContext.
+// Handled message is recorded in the same transaction, and is skipped when it is delivered again.
+func (srv *RPCServer) UseInbox(inbox *SQLInbox) {
+	srv.locker.Lock()
+	srv.inbox = inbox
+	srv.locker.Unlock()
+}
+
+// ReplaceReplyEncoder replaces encode function of replies
+func (srv *RPCServer) ReplaceReplyEncoder(encFnc PayloadEncodeFnc) {
+	srv.locker.Lock()
+	srv.replyEncode = encFnc
+	srv.locker.Unlock()
+}
+
+// UseBlobStore sets blob store that offloaded payloads are fetched from.
+// Blob is deleted after its message is handled and deleted successfully,
+// except blob of message published to a topic, which is expired by blob store.
+func (srv *RPCServer) UseBlobStore(store BlobStore) {
+	srv.locker.Lock()
+	srv.blobStore = store
+	srv.locker.Unlock()
+}
+
+// UseKeyProvider sets key provider that decrypts data keys of encrypted payloads.
+// Payload of replies is encrypted by data keys from it too.
+func (srv *RPCServer) UseKeyProvider(kp KeyProvider) {
+	srv.locker.Lock()
+	srv.keyProvider = kp
+	srv.locker.Unlock()
+}
+
+// UseSigner makes server sign all replies by given signer, see RPCClient.UseVerifier
+func (srv *RPCServer) UseSigner(signer Signer) {
+	srv.locker.Lock()
+	srv.signer = signer
+	srv.locker.Unlock()
+}
+
+// UseVerifier makes server verify signature of all messages before dispatching them.
+// Messages sent out of replay window are rejected too, if replay window is positive.
+// Unsigned and invalid messages are dead-lettered if dead letter sender is set, or dropped otherwise.
+func (srv *RPCServer) UseVerifier(verifier Verifier, replayWindow time.Duration) {
+	srv.locker.Lock()
+	srv.verifier = verifier
+	srv.replayWindow = replayWindow
+	srv.locker.Unlock()
+}
+
+// UseKeyIdentities sets identities of senders by id of their signing keys.
+// Sender of message verified by server has identity of its signing key, or key id as principal
+// if key has no identity. Message claiming another principal or role in metadata is rejected.
+func (srv *RPCServer) UseKeyIdentities(identities map[string]Identity) {
+	srv.locker.Lock()
+	srv.keyIdentities = identities
+	srv.locker.Unlock()
+}
+
+// UseAuthorizer makes server check that sender of each message is allowed to invoke its method,
+// before decoding the message. Message published to a topic is authorized as topic service with empty method.
+// Denied messages are audited by given audit func if any, then dead-lettered or dropped as rejected messages.
+// Identity of sender is trusted only if it is bound to signing key of message,
+// so Serve fails unless a verifier is set by UseVerifier.
+func (srv *RPCServer) UseAuthorizer(authorizer Authorizer, audit AuthzAuditFnc) {
+	srv.locker.Lock()
+	srv.authorizer = authorizer
+	srv.authzAudit = audit
+	srv.locker.Unlock()
+}
+
+// SetDeadLetterSender sets sender that rejected messages are sent to
+func (srv *RPCServer) SetDeadLetterSender(sender MessageSender) {
+	srv.locker.Lock()
+	srv.deadLetter = sender
+	srv.locker.Unlock()
+}
+
 // RegisterService adds new service to server by name and description.
 // This method SHOULD NOT be called directly outside of RegisterXService() method of each service
 func (srv *RPCServer) RegisterService(svc interface{}, svName ServiceName, svDesc ServiceDescription) {
@@ -96,6 +311,21 @@ func (srv *RPCServer) RegisterService(svc interface{}, svName ServiceName, svDes
 	srv.locker.Unlock()
 }
 
+// topicHandler handles messages published to a topic
+type topicHandler struct {
+	svc  interface{}
+	desc MethodDescription
+}
+
+// RegisterTopic makes server handle messages published to given topic by handler of given description.
+// The svc is passed to the handler as its service instance. Server receives published messages
+// from subscriptions added by AddQueue.
+func (srv *RPCServer) RegisterTopic(topic string, svc interface{}, desc MethodDescription) {
+	srv.locker.Lock()
+	srv.topics[topic] = topicHandler{svc: svc, desc: desc}
+	srv.locker.Unlock()
+}
+
 // ListenQuitSigs listen on signals that make server quit when received.
 // This should be called before Serve method
 func (srv *RPCServer) ListenQuitSigs(sigs ...os.Signal) {
@@ -106,80 +336,525 @@ func (srv *RPCServer) ListenQuitSigs(sigs ...os.Signal) {
 	signal.Notify(srv.exitChan, sigs...)
 }
 
-// Serve processes all incoming messages
+// Serve processes all incoming messages of all queues.
+// It returns when server is stopped, or on error of any queue.
 func (srv *RPCServer) Serve() error {
 	defer srv.shutdown()
 
-	for {
-		msgs, err := srv.msgReceiver.ReceiveMsg()
+	if len(srv.queues) == 0 {
+		return errors.New("no queue to receive messages from")
+	}
+	if srv.authorizer != nil && srv.verifier == nil {
+		return errors.New("authorizer requires verifier, identity in metadata of unverified message is not trusted")
+	}
+	srv.splitWorkers()
+	for _, q := range srv.queues {
+		if mr, ok := q.receiver.(metricsRecorder); ok {
+			mr.SetMetrics(srv.metrics)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(srv.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case sig, ok := <-srv.exitChan:
+			if ok {
+				srv.logger.Info("stop receiving message", Field{Key: "signal", Value: sig.String()})
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	srv.stats.heartbeat()
+	eg, queueCtx := errgroup.WithContext(ctx)
+	for _, q := range srv.queues {
+		q := q
+		eg.Go(func() error {
+			return srv.serveQueue(queueCtx, q)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// pausedPollInterval is the interval to check for stop while server is paused
+const pausedPollInterval = time.Second
+
+// waitForStop waits up to given duration for given context to be done,
+// by stopping server or by error of other queues. It returns true if server should stop.
+func (srv *RPCServer) waitForStop(ctx context.Context, wait time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (srv *RPCServer) handleMsg(q *serverQueue, msg *RPCMessage) (err error) {
+	start := time.Now()
+	srv.logger.Debug("handle message", msgFields(msg)...)
+	dwell := dwellTime(msg)
+	srv.metrics.MsgReceived(msg.SvrName, msg.MthName, dwell)
+	srv.metrics.InFlight(1)
+	atomic.AddInt64(&srv.stats.inFlight, 1)
+	doneHandling := srv.stats.startHandling()
+	defer func() {
+		doneHandling()
+		srv.metrics.InFlight(-1)
+		atomic.AddInt64(&srv.stats.inFlight, -1)
+		srv.metrics.MsgHandled(msg.SvrName, msg.MthName, time.Since(start), err)
+		if msg.lane != "" {
+			srv.metrics.LaneHandled(msg.lane, dwell, time.Since(start), err)
+		}
 		if err != nil {
-			return errors.Wrap(err, "error on receive message")
+			atomic.AddInt64(&srv.stats.failed, 1)
+			srv.logger.Error("cannot handle message", msgFields(msg, latencyField(start), errField(err))...)
+			return
 		}
+		atomic.AddInt64(&srv.stats.handled, 1)
+		srv.logger.Info("handled message", msgFields(msg, latencyField(start))...)
+	}()
 
-		eg, _ := errgroup.WithContext(srv.ctx)
-		for _, msg := range msgs {
-			eg.Go(func() error {
-				return srv.handleMsg(msg)
-			})
+	ctx, span := srv.tracer.StartConsumer(srv.ctx, msg)
+	defer func() {
+		span.End(err)
+	}()
+	if !msg.receivedAt.IsZero() {
+		_, receiveSpan := srv.tracer.StartStep(ctx, StepReceive, msg.receivedAt)
+		receiveSpan.End(nil)
+	}
+
+	if srv.verifier != nil {
+		if err := verifyMsg(msg, srv.verifier, srv.replayWindow); err != nil {
+			return srv.rejectMsg(q, msg, err)
+		}
+	}
+	if srv.authorizer != nil || srv.verifier != nil {
+		// authorize the handler that message is dispatched to, see handlerOf
+		svr, mth := dispatchTarget(msg)
+		id, err := srv.identityOf(msg)
+		if err == nil && srv.authorizer != nil {
+			err = srv.authorizer.Authorize(id, svr, mth)
 		}
-		if err := eg.Wait(); err != nil {
-			return errors.Wrapf(err, "error on handle message: %+v", msgs)
+		if err != nil {
+			if srv.authzAudit != nil {
+				srv.authzAudit(id, svr, mth, err)
+			}
+			err = errors.Wrap(err, "unauthorized")
+			srv.replyError(msg, err)
+			return srv.rejectMsg(q, msg, err)
 		}
+	}
 
-		select {
-		case <-srv.ctx.Done():
-			return nil
-		case sig := <-srv.exitChan:
-			fmt.Println("stop receiving message, got signal: ", sig.String())
-			return nil
-		default:
+	svc, mthd, err := srv.handlerOf(msg)
+	if err != nil {
+		return err
+	}
+
+	// expiry is checked before decoding, so a backlog of expired messages drains quickly
+	expiresAt := msg.expiresAt(mthd.TTL)
+	if expiresAt != 0 && time.Now().UnixNano() > expiresAt {
+		return srv.expireMsg(q, msg, expiresAt)
+	}
+	if msg.remainingDelay() > 0 {
+		return srv.requeueMsg(q, msg)
+	}
+	if rec, ok, err := srv.handledRecord(msg); err != nil {
+		return err
+	} else if ok {
+		return srv.skipDuplicate(q, msg, rec)
+	}
+
+	_, decodeSpan := srv.tracer.StartStep(ctx, StepDecode, time.Now())
+	in, err := srv.decodeMsg(msg, mthd)
+	decodeSpan.End(err)
+	if err != nil {
+		return err
+	}
+
+	handleCtx, handleSpan := srv.tracer.StartStep(ctx, StepHandle, time.Now())
+	if expiresAt != 0 {
+		var cancel context.CancelFunc
+		handleCtx, cancel = context.WithDeadline(handleCtx, time.Unix(0, expiresAt))
+		defer cancel()
+	}
+	var tx *sql.Tx
+	if srv.inbox != nil {
+		if tx, err = srv.inbox.begin(handleCtx); err != nil {
+			handleSpan.End(err)
+			return err
+		}
+		// no-op once committed
+		defer tx.Rollback()
+		handleCtx = context.WithValue(handleCtx, txKey{}, tx)
+	}
+	out, err := mthd.Handler(handleCtx, svc, in)
+	handleSpan.End(err)
+	if err == nil {
+		err = srv.completeMsg(tx, msg, out)
+	}
+	if err == nil && q.deleter != nil {
+		_, deleteSpan := srv.tracer.StartStep(ctx, StepDelete, time.Now())
+		err := srv.deleteHandledMsg(q, msg)
+		deleteSpan.End(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// deleteHandledMsg deletes handled message from given queue, then its offloaded payload if any.
+// Payload of message published to a topic is shared by all consumer groups, so it is kept.
+func (srv *RPCServer) deleteHandledMsg(q *serverQueue, msg *RPCMessage) error {
+	if err := srv.deleteMsg(q, msg); err != nil {
+		return err
+	}
+
+	if msg.PayloadRef != "" && msg.Topic == "" {
+		if err := srv.blobStore.DeleteBlob(msg.PayloadRef); err != nil {
+			return errors.Wrapf(err, "cannot delete offloaded payload %s", msg.PayloadRef)
 		}
 	}
+
+	return nil
 }
 
-func (srv *RPCServer) handleMsg(msg *RPCMessage) error {
-	fmt.Printf("==> handle msg: %p\n", msg)
+// dispatchTarget returns service and method that message is dispatched to.
+// Message published to a topic is dispatched to handler of its topic, as service without method.
+func dispatchTarget(msg *RPCMessage) (ServiceName, MethodName) {
+	if msg.Topic != "" {
+		return ServiceName(msg.Topic), ""
+	}
+
+	return msg.SvrName, msg.MthName
+}
+
+// handlerOf returns registered service instance and method description of given message,
+// by its topic if it is published to a topic
+func (srv *RPCServer) handlerOf(msg *RPCMessage) (interface{}, MethodDescription, error) {
+	if msg.Topic != "" {
+		th, ok := srv.topics[msg.Topic]
+		if !ok {
+			return nil, MethodDescription{}, fmt.Errorf("no handler for topic %s", msg.Topic)
+		}
+		return th.svc, th.desc, nil
+	}
+
 	// get registered service description from server
 	svd, ok := srv.servicesDesc[msg.SvrName]
 	if !ok {
-		return fmt.Errorf("no service description for %s", msg.SvrName)
+		return nil, MethodDescription{}, fmt.Errorf("no service description for %s", msg.SvrName)
 	}
 
 	// get registered method description from service
 	mthd, ok := svd.Methods[msg.MthName]
 	if !ok {
-		return fmt.Errorf("no method description for %s", msg.MthName)
+		return nil, MethodDescription{}, fmt.Errorf("no method description for %s", msg.MthName)
 	}
 
 	// get registered service instance from server
 	svc, ok := srv.services[msg.SvrName]
 	if !ok {
-		return fmt.Errorf("no service instance for %s", msg.SvrName)
+		return nil, MethodDescription{}, fmt.Errorf("no service instance for %s", msg.SvrName)
 	}
 
-	// decode payload
+	return svc, mthd, nil
+}
+
+// retryMsg leaves failed message in the queue to be retried,
+// or dead-letters it if it reaches max attempts.
+// It returns error if server should stop.
+func (srv *RPCServer) retryMsg(q *serverQueue, msg *RPCMessage, err error) error {
+	if srv.maxAttempts <= 0 {
+		return err
+	}
+
+	if msg.attempt >= srv.maxAttempts {
+		err = errors.Wrapf(err, "failed after %d attempts", msg.attempt)
+		srv.replyError(msg, err)
+		return srv.rejectMsg(q, msg, err)
+	}
+	srv.logger.Warn("message will be retried", msgFields(msg, errField(err))...)
+
+	return nil
+}
+
+// handledRecord returns record of message if it is already handled, by dedup store or inbox of server
+func (srv *RPCServer) handledRecord(msg *RPCMessage) (DedupRecord, bool, error) {
+	if srv.dedupStore != nil {
+		rec, ok, err := srv.dedupStore.Get(msg.ID)
+		if err != nil || ok {
+			return rec, ok, errors.Wrapf(err, "cannot look up handled msg %s", msg.ID)
+		}
+	}
+	if srv.inbox != nil {
+		rec, ok, err := srv.inbox.Get(msg.ID)
+		return rec, ok, errors.Wrapf(err, "cannot look up handled msg %s in inbox", msg.ID)
+	}
+
+	return DedupRecord{}, false, nil
+}
+
+// completeMsg commits inbox transaction of handled message if any, records it in dedup store if any,
+// and replies result of its handler if it asks for reply
+func (srv *RPCServer) completeMsg(tx *sql.Tx, msg *RPCMessage, out interface{}) error {
+	var payload []byte
+	if msg.ReplyTo != "" && out != nil {
+		var err error
+		if payload, err = srv.replyEncode(out); err != nil {
+			return errors.Wrapf(err, "cannot encode reply of type %T", out)
+		}
+	}
+
+	if tx != nil {
+		// a concurrent duplicate recorded first fails this one, which is skipped when it is retried
+		if err := srv.inbox.commit(tx, msg.ID, payload); err != nil {
+			return err
+		}
+	}
+	if srv.dedupStore != nil {
+		rec := DedupRecord{Reply: payload, HandledAt: time.Now()}
+		if err := srv.dedupStore.Put(msg.ID, rec); err != nil {
+			return errors.Wrapf(err, "cannot record handled msg %s", msg.ID)
+		}
+	}
+	if msg.ReplyTo != "" {
+		return srv.sendReply(msg, payload, nil)
+	}
+
+	return nil
+}
+
+// skipDuplicate deletes message that is already handled without handling it again,
+// and replies its cached result if it asks for reply
+func (srv *RPCServer) skipDuplicate(q *serverQueue, msg *RPCMessage, rec DedupRecord) error {
+	srv.logger.Info("skip duplicate message", msgFields(msg, Field{Key: "handled_at", Value: rec.HandledAt})...)
+	if msg.ReplyTo != "" {
+		if err := srv.sendReply(msg, rec.Reply, nil); err != nil {
+			return err
+		}
+	}
+	if q.deleter == nil {
+		return nil
+	}
+
+	return srv.deleteHandledMsg(q, msg)
+}
+
+// sendReply sends encoded result of handler, or error of message, to reply queue of message
+func (srv *RPCServer) sendReply(msg *RPCMessage, payload []byte, msgErr error) error {
+	if srv.replySender == nil {
+		srv.logger.Warn("no reply sender, reply is dropped", msgFields(msg, Field{Key: FieldReplyTo, Value: msg.ReplyTo})...)
+		return nil
+	}
+
+	reply := &RPCMessage{
+		ID:            newID(),
+		SvrName:       msg.SvrName,
+		MthName:       msg.MthName,
+		CorrelationID: msg.ID,
+		Timestamp:     time.Now().UnixNano(),
+	}
+	if msgErr != nil {
+		reply.ReplyError = msgErr.Error()
+	} else {
+		reply.Payload = payload
+	}
+	if srv.keyProvider != nil && len(reply.Payload) > 0 {
+		if err := encryptPayload(reply, srv.keyProvider); err != nil {
+			return errors.Wrapf(err, "cannot encrypt reply of msg %s", msg.ID)
+		}
+	}
+	if srv.signer != nil {
+		if err := signMsg(reply, srv.signer); err != nil {
+			return errors.Wrapf(err, "cannot sign reply of msg %s", msg.ID)
+		}
+	}
+
+	if err := srv.replySender.SendReply(msg.ReplyTo, reply); err != nil {
+		return errors.Wrapf(err, "cannot send reply of msg %s", msg.ID)
+	}
+
+	return nil
+}
+
+// replyError replies error of message that is given up, if it asks for reply,
+// so its client does not wait until timeout
+func (srv *RPCServer) replyError(msg *RPCMessage, msgErr error) {
+	if msg.ReplyTo == "" {
+		return
+	}
+	if err := srv.sendReply(msg, nil, msgErr); err != nil {
+		srv.logger.Error("cannot reply error", msgFields(msg, errField(err))...)
+	}
+}
+
+// decodeMsg restores payload of message, then decodes it to input of method
+func (srv *RPCServer) decodeMsg(msg *RPCMessage, mthd MethodDescription) (interface{}, error) {
 	decodeFnc := mthd.PayloadDecode
 	if decodeFnc == nil {
 		// fallback to server default decode func
 		decodeFnc = srv.payloadDecode
 	}
 
-	in, err := mthd.DecodeHandle(decodeFnc, msg.Payload)
+	payload, err := srv.fetchPayload(msg)
+	if err != nil {
+		return nil, err
+	}
+	if payload, err = decryptPayload(msg, payload, srv.keyProvider); err != nil {
+		return nil, err
+	}
+	if payload, err = decompressPayload(msg.Compression, payload); err != nil {
+		return nil, err
+	}
+
+	in, err := mthd.DecodeHandle(decodeFnc, payload)
 	if err != nil {
-		return errors.Wrapf(err, "cannot decode payload msg", msg.Payload)
+		return nil, errors.Wrapf(err, "cannot decode payload %s", payloadRedact(payload))
+	}
+
+	return in, nil
+}
+
+// fetchPayload returns payload of message, fetching from blob store if it was offloaded
+func (srv *RPCServer) fetchPayload(msg *RPCMessage) ([]byte, error) {
+	if msg.PayloadRef == "" {
+		return msg.Payload, nil
+	}
+	if srv.blobStore == nil {
+		return nil, fmt.Errorf("no blob store for offloaded payload %s", msg.PayloadRef)
+	}
+
+	payload, err := srv.blobStore.GetBlob(msg.PayloadRef)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot fetch offloaded payload %s", msg.PayloadRef)
+	}
+	digest := sha256.Sum256(payload)
+	if !bytes.Equal(digest[:], msg.PayloadDigest) {
+		return nil, errors.Errorf("digest mismatch of offloaded payload %s", msg.PayloadRef)
+	}
+
+	return payload, nil
+}
+
+// requeueMsg sends message that arrives before its delivery time back to queue
+// with remaining delay, then deletes the original one
+func (srv *RPCServer) requeueMsg(q *serverQueue, msg *RPCMessage) error {
+	requeueSender := q.requeueSender
+	if requeueSender == nil {
+		requeueSender = srv.requeueSender
+	}
+	if requeueSender == nil {
+		return fmt.Errorf("no requeue sender for delayed msg of %s/%s", msg.SvrName, msg.MthName)
 	}
 
-	_, err = mthd.Handler(srv.ctx, svc, in)
-	if err == nil && srv.msgDeleter != nil {
-		if err := srv.msgDeleter.DeleteMsg(msg); err != nil {
-			return errors.Wrapf(err, "cannot delete msg: %+v", msg)
+	if err := sendMsg(requeueSender, msg); err != nil {
+		return errors.Wrapf(err, "cannot requeue delayed msg of %s/%s", msg.SvrName, msg.MthName)
+	}
+
+	if q.deleter != nil {
+		return srv.deleteMsg(q, msg)
+	}
+
+	return nil
+}
+
+// expireMsg drops or dead-letters message that expired at given time before it is handled,
+// by expired action of server
+func (srv *RPCServer) expireMsg(q *serverQueue, msg *RPCMessage, expiresAt int64) error {
+	atomic.AddInt64(&srv.stats.expired, 1)
+	srv.metrics.MsgExpired(msg.SvrName, msg.MthName)
+
+	reason := errors.Errorf("expired at %s", time.Unix(0, expiresAt).UTC().Format(time.RFC3339Nano))
+	if srv.expiredAction == ExpiredDeadLetter {
+		return srv.rejectMsg(q, msg, reason)
+	}
+
+	srv.logger.Warn("drop expired message", msgFields(msg, errField(reason))...)
+	if q.deleter != nil {
+		if err := srv.deleteMsg(q, msg); err != nil {
+			return err
+		}
+	}
+	if msg.PayloadRef != "" && srv.blobStore != nil {
+		if err := srv.blobStore.DeleteBlob(msg.PayloadRef); err != nil {
+			return errors.Wrapf(err, "cannot delete offloaded payload %s", msg.PayloadRef)
 		}
-		fmt.Printf("--> delete msg: %p\n", msg)
 	}
 
-	return err
+	return nil
+}
+
+// rejectMsg sends message that must not be handled to dead letter queue if any,
+// then deletes it from the queue, so it is not retried
+func (srv *RPCServer) rejectMsg(q *serverQueue, msg *RPCMessage, reason error) error {
+	srv.logger.Warn("reject message", msgFields(msg, errField(reason))...)
+	if srv.deadLetter != nil {
+		if err := srv.deadLetter.SendAsyncMsg(msg); err != nil {
+			return errors.Wrapf(err, "cannot dead-letter msg of %s/%s", msg.SvrName, msg.MthName)
+		}
+		srv.metrics.MsgDeadLettered(msg.SvrName, msg.MthName)
+	}
+
+	if q.deleter != nil {
+		return srv.deleteMsg(q, msg)
+	}
+
+	return nil
+}
+
+// deleteMsg deletes message from given queue
+func (srv *RPCServer) deleteMsg(q *serverQueue, msg *RPCMessage) error {
+	if err := q.deleter.DeleteMsg(msg); err != nil {
+		return errors.Wrapf(err, "cannot delete msg: %+v", msg)
+	}
+	srv.logger.Debug("deleted message", msgFields(msg)...)
+	srv.metrics.MsgDeleted(msg.SvrName, msg.MthName)
+
+	return nil
+}
+
+// groupMsgs splits messages into groups by their message group id, keeping received order.
+// Each message without group id is put into its own group.
+func groupMsgs(msgs []*RPCMessage) [][]*RPCMessage {
+	groups := make([][]*RPCMessage, 0, len(msgs))
+	groupIdx := make(map[string]int)
+	for _, msg := range msgs {
+		if msg.GroupID == "" {
+			groups = append(groups, []*RPCMessage{msg})
+			continue
+		}
+
+		idx, ok := groupIdx[msg.GroupID]
+		if !ok {
+			idx = len(groups)
+			groupIdx[msg.GroupID] = idx
+			groups = append(groups, nil)
+		}
+		groups[idx] = append(groups[idx], msg)
+	}
+
+	return groups
 }
 
 func (srv *RPCServer) shutdown() {
+	atomic.StoreInt32(&srv.stats.shuttingDown, 1)
+	srv.stopAdmin()
 	close(srv.exitChan)
 }
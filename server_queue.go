@@ -0,0 +1,175 @@
+package myrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultQueueName is name of queue given to NewRPCServer
+const DefaultQueueName = "default"
+
+// serverQueue is a queue that server receives messages from
+type serverQueue struct {
+	name          string
+	receiver      MessageReceiver
+	deleter       MessageDeleter
+	requeueSender MessageSender
+	weight        int
+	concurrency   int
+	// workers limits number of groups of this queue handled concurrently, nil if unlimited
+	workers     chan struct{}
+	busyWorkers int64
+	batches     int64
+}
+
+// QueueOption configures a queue of RPCServer
+type QueueOption func(*serverQueue)
+
+// WithQueueWeight sets weight of queue, 1 by default.
+// Concurrency of server is split among queues by their weights.
+func WithQueueWeight(weight int) QueueOption {
+	return func(q *serverQueue) {
+		q.weight = weight
+	}
+}
+
+// WithQueueConcurrency limits number of workers of queue,
+// instead of its share of concurrency of server
+func WithQueueConcurrency(n int) QueueOption {
+	return func(q *serverQueue) {
+		q.concurrency = n
+	}
+}
+
+// WithQueueRequeueSender sets sender that re-enqueues delayed messages of queue,
+// see RPCServer.SetRequeueSender
+func WithQueueRequeueSender(sender MessageSender) QueueOption {
+	return func(q *serverQueue) {
+		q.requeueSender = sender
+	}
+}
+
+// AddQueue makes server receive messages from one more queue by given receiver,
+// and delete them by given deleter. Each queue is polled by its own loop.
+// This should be called before Serve method
+func (srv *RPCServer) AddQueue(name string, mr MessageReceiver, md MessageDeleter, opts ...QueueOption) {
+	q := &serverQueue{
+		name:     name,
+		receiver: mr,
+		deleter:  md,
+		weight:   1,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	srv.locker.Lock()
+	srv.queues = append(srv.queues, q)
+	srv.locker.Unlock()
+}
+
+// splitWorkers sets worker limit of each queue: its own concurrency if set,
+// or its share of server concurrency by weight
+func (srv *RPCServer) splitWorkers() {
+	srv.locker.Lock()
+	defer srv.locker.Unlock()
+
+	totalWeight := 0
+	for _, q := range srv.queues {
+		if q.concurrency <= 0 && q.weight > 0 {
+			totalWeight += q.weight
+		}
+	}
+
+	for _, q := range srv.queues {
+		n := q.concurrency
+		if n <= 0 && srv.workers != nil && totalWeight > 0 {
+			// round up, so each queue has at least 1 worker
+			n = (cap(srv.workers)*q.weight + totalWeight - 1) / totalWeight
+		}
+		q.workers = nil
+		if n > 0 {
+			q.workers = make(chan struct{}, n)
+		}
+	}
+}
+
+// serveQueue processes incoming messages of given queue until ctx is done.
+// It returns nil if server is stopped.
+func (srv *RPCServer) serveQueue(ctx context.Context, q *serverQueue) error {
+	for {
+		if srv.isPaused() {
+			// keep heartbeat, so paused server is still alive
+			srv.stats.heartbeat()
+			if srv.waitForStop(ctx, pausedPollInterval) {
+				return nil
+			}
+			continue
+		}
+
+		receivedAt := time.Now()
+		msgs, err := q.receiver.ReceiveMsg()
+		if err != nil {
+			return errors.Wrapf(err, "error on receive message from queue %s", q.name)
+		}
+		srv.stats.heartbeat()
+		atomic.AddInt64(&srv.stats.batches, 1)
+		atomic.AddInt64(&q.batches, 1)
+		srv.metrics.BatchReceived(len(msgs))
+		for _, msg := range msgs {
+			msg.receivedAt = receivedAt
+		}
+
+		eg, _ := errgroup.WithContext(srv.ctx)
+		for _, group := range groupMsgs(msgs) {
+			group := group
+			srv.acquireWorker(q)
+			eg.Go(func() error {
+				defer srv.releaseWorker(q)
+				// messages in same group are handled one at a time to keep their order
+				for _, msg := range group {
+					if err := srv.handleMsg(q, msg); err != nil {
+						// rest of group is retried later with the failed message
+						return srv.retryMsg(q, msg, err)
+					}
+				}
+				return nil
+			})
+		}
+		// liveness is kept by age of running handlers until they finish, see NewAdminHandler
+		if err := eg.Wait(); err != nil {
+			return errors.Wrapf(err, "error on handle message: %+v", msgs)
+		}
+
+		if srv.waitForStop(ctx, 0) {
+			return nil
+		}
+	}
+}
+
+// acquireWorker waits for a worker of given queue, then a worker of server
+func (srv *RPCServer) acquireWorker(q *serverQueue) {
+	if q.workers != nil {
+		q.workers <- struct{}{}
+	}
+	if srv.workers != nil {
+		srv.workers <- struct{}{}
+	}
+	atomic.AddInt64(&q.busyWorkers, 1)
+	atomic.AddInt64(&srv.stats.busyWorkers, 1)
+}
+
+func (srv *RPCServer) releaseWorker(q *serverQueue) {
+	atomic.AddInt64(&srv.stats.busyWorkers, -1)
+	atomic.AddInt64(&q.busyWorkers, -1)
+	if srv.workers != nil {
+		<-srv.workers
+	}
+	if q.workers != nil {
+		<-q.workers
+	}
+}
@@ -0,0 +1,182 @@
+package myrpc
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServerStats is a snapshot of state of RPCServer
+type ServerStats struct {
+	// LastPoll is the last time poll loop made progress
+	LastPoll     time.Time `json:"last_poll"`
+	Paused       bool      `json:"paused"`
+	ShuttingDown bool      `json:"shutting_down"`
+	// InFlight is number of messages being handled
+	InFlight int64 `json:"in_flight"`
+	// OldestInFlight is the time server started handling the oldest message being handled,
+	// zero if no message is being handled
+	OldestInFlight time.Time    `json:"oldest_in_flight"`
+	Handled        int64        `json:"handled"`
+	Failed         int64        `json:"failed"`
+	Expired        int64        `json:"expired"`
+	Batches        int64        `json:"batches"`
+	Workers        WorkerStats  `json:"workers"`
+	Queues         []QueueStats `json:"queues"`
+}
+
+// QueueStats is a snapshot of a queue of RPCServer
+type QueueStats struct {
+	Name    string      `json:"name"`
+	Weight  int         `json:"weight"`
+	Batches int64       `json:"batches"`
+	Workers WorkerStats `json:"workers"`
+}
+
+// WorkerStats is a snapshot of worker pool of RPCServer.
+// Each worker handles a group of messages, Size is 0 if pool is unlimited.
+type WorkerStats struct {
+	Size int `json:"size"`
+	Busy int `json:"busy"`
+}
+
+// ServiceInfo describes a registered service and its methods
+type ServiceInfo struct {
+	Name    ServiceName  `json:"name"`
+	Methods []MethodName `json:"methods"`
+}
+
+// serverStats contains counters of server, updated atomically
+type serverStats struct {
+	lastPoll     int64
+	paused       int32
+	shuttingDown int32
+	inFlight     int64
+	handled      int64
+	failed       int64
+	expired      int64
+	batches      int64
+	busyWorkers  int64
+	// clock returns current time, time.Now if nil
+	clock  func() time.Time
+	locker sync.Mutex
+	// start times of messages being handled, by sequence of handling
+	handling    map[int64]time.Time
+	handlingSeq int64
+}
+
+func (st *serverStats) now() time.Time {
+	if st.clock == nil {
+		return time.Now()
+	}
+
+	return st.clock()
+}
+
+func (st *serverStats) heartbeat() {
+	atomic.StoreInt64(&st.lastPoll, st.now().UnixNano())
+}
+
+// startHandling records start of handling a message, until returned func is called
+func (st *serverStats) startHandling() (done func()) {
+	st.locker.Lock()
+	defer st.locker.Unlock()
+	if st.handling == nil {
+		st.handling = make(map[int64]time.Time)
+	}
+	st.handlingSeq++
+	seq := st.handlingSeq
+	st.handling[seq] = st.now()
+
+	return func() {
+		st.locker.Lock()
+		delete(st.handling, seq)
+		st.locker.Unlock()
+	}
+}
+
+// oldestHandling returns start time of the oldest message being handled, or zero time if none
+func (st *serverStats) oldestHandling() time.Time {
+	st.locker.Lock()
+	defer st.locker.Unlock()
+	var oldest time.Time
+	for _, start := range st.handling {
+		if oldest.IsZero() || start.Before(oldest) {
+			oldest = start
+		}
+	}
+
+	return oldest
+}
+
+// Stats returns snapshot of state of server
+func (srv *RPCServer) Stats() ServerStats {
+	st := &srv.stats
+	srv.locker.Lock()
+	defer srv.locker.Unlock()
+	queues := make([]QueueStats, len(srv.queues))
+	for i, q := range srv.queues {
+		queues[i] = QueueStats{
+			Name:    q.name,
+			Weight:  q.weight,
+			Batches: atomic.LoadInt64(&q.batches),
+			Workers: WorkerStats{
+				Size: cap(q.workers),
+				Busy: int(atomic.LoadInt64(&q.busyWorkers)),
+			},
+		}
+	}
+
+	return ServerStats{
+		LastPoll:       time.Unix(0, atomic.LoadInt64(&st.lastPoll)),
+		Paused:         atomic.LoadInt32(&st.paused) == 1,
+		ShuttingDown:   atomic.LoadInt32(&st.shuttingDown) == 1,
+		InFlight:       atomic.LoadInt64(&st.inFlight),
+		OldestInFlight: st.oldestHandling(),
+		Handled:        atomic.LoadInt64(&st.handled),
+		Failed:         atomic.LoadInt64(&st.failed),
+		Expired:        atomic.LoadInt64(&st.expired),
+		Batches:        atomic.LoadInt64(&st.batches),
+		Workers: WorkerStats{
+			Size: cap(srv.workers),
+			Busy: int(atomic.LoadInt64(&st.busyWorkers)),
+		},
+		Queues: queues,
+	}
+}
+
+// Services returns all registered services and their methods, sorted by name
+func (srv *RPCServer) Services() []ServiceInfo {
+	srv.locker.Lock()
+	defer srv.locker.Unlock()
+
+	infos := make([]ServiceInfo, 0, len(srv.servicesDesc))
+	for name, desc := range srv.servicesDesc {
+		info := ServiceInfo{Name: name, Methods: make([]MethodName, 0, len(desc.Methods))}
+		for mth := range desc.Methods {
+			info.Methods = append(info.Methods, mth)
+		}
+		sort.Slice(info.Methods, func(i, j int) bool { return info.Methods[i] < info.Methods[j] })
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+// Pause stops receiving new messages, messages being handled are not affected
+func (srv *RPCServer) Pause() {
+	atomic.StoreInt32(&srv.stats.paused, 1)
+	srv.logger.Info("paused receiving message")
+}
+
+// Resume restarts receiving messages after Pause
+func (srv *RPCServer) Resume() {
+	atomic.StoreInt32(&srv.stats.paused, 0)
+	srv.logger.Info("resumed receiving message")
+}
+
+func (srv *RPCServer) isPaused() bool {
+	return atomic.LoadInt32(&srv.stats.paused) == 1
+}
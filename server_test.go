@@ -0,0 +1,171 @@
+package myrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expiryMetrics records expired and dead-lettered messages
+type expiryMetrics struct {
+	NopMetrics
+	locker       sync.Mutex
+	expired      []string
+	deadLettered []string
+}
+
+func (m *expiryMetrics) MsgExpired(svr ServiceName, mth MethodName) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	m.expired = append(m.expired, routeKey(svr, mth))
+}
+
+func (m *expiryMetrics) MsgDeadLettered(svr ServiceName, mth MethodName) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	m.deadLettered = append(m.deadLettered, routeKey(svr, mth))
+}
+
+func TestExpiredMsgIsNotHandled(t *testing.T) {
+	past, now := time.Now().Add(-time.Hour).UnixNano(), time.Now().UnixNano()
+	tests := []struct {
+		name           string
+		action         ExpiredAction
+		mth            MethodName
+		msg            RPCMessage
+		wantHandled    bool
+		wantExpired    bool
+		wantDeadLetter bool
+	}{
+		{name: "deadline passed", mth: "plain", msg: RPCMessage{Timestamp: now, Deadline: past}, wantExpired: true},
+		{name: "ttl of method passed", mth: "ttl", msg: RPCMessage{Timestamp: past}, wantExpired: true},
+		{name: "ttl passed after delivery time", mth: "ttl", msg: RPCMessage{Timestamp: past, DeliverAt: past + int64(time.Minute)},
+			wantExpired: true},
+		{name: "expired is dead-lettered", action: ExpiredDeadLetter, mth: "ttl", msg: RPCMessage{Timestamp: past},
+			wantExpired: true, wantDeadLetter: true},
+		{name: "ttl not passed", mth: "ttl", msg: RPCMessage{Timestamp: now}, wantHandled: true},
+		{name: "no ttl nor deadline", mth: "plain", msg: RPCMessage{Timestamp: past}, wantHandled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemoryQueue()
+			deadLetter := &recordingSender{}
+			metrics := &expiryMetrics{}
+			srv := NewRPCServer(context.Background(), q, q)
+			srv.SetDeadLetterSender(deadLetter)
+			srv.SetMetrics(metrics)
+			if tt.action != "" {
+				srv.SetExpiredAction(tt.action)
+			}
+			handled := false
+			handler := func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+				handled = true
+				return nil, nil
+			}
+			decode := func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+				return nil, nil
+			}
+			srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+				"plain": {Name: "plain", Handler: handler, DecodeHandle: decode},
+				"ttl":   {Name: "ttl", Handler: handler, DecodeHandle: decode, TTL: 10 * time.Minute},
+			}})
+
+			msg := tt.msg
+			msg.ID, msg.SvrName, msg.MthName, msg.Payload = newID(), "svc", tt.mth, []byte("{}")
+			if err := q.SendAsyncMsg(&msg); err != nil {
+				t.Fatal(err)
+			}
+			received, err := q.ReceiveMsg()
+			if err != nil || len(received) != 1 {
+				t.Fatalf("ReceiveMsg() = %v, %v", received, err)
+			}
+			if err := srv.handleMsg(srv.queues[0], received[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			if handled != tt.wantHandled {
+				t.Errorf("handled %t, want %t", handled, tt.wantHandled)
+			}
+			if expired := len(metrics.expired) == 1 && metrics.expired[0] == "svc/"+string(tt.mth); expired != tt.wantExpired {
+				t.Errorf("expired metrics %v, want expired %t", metrics.expired, tt.wantExpired)
+			}
+			if deadLettered := len(deadLetter.msgs) == 1 && len(metrics.deadLettered) == 1; deadLettered != tt.wantDeadLetter {
+				t.Errorf("dead-lettered %d messages, metrics %v, want dead-lettered %t",
+					len(deadLetter.msgs), metrics.deadLettered, tt.wantDeadLetter)
+			}
+			if q.Len() != 0 {
+				t.Errorf("message is not deleted from queue")
+			}
+			if stats := srv.Stats(); (stats.Expired == 1) != tt.wantExpired {
+				t.Errorf("expired stats %d, want expired %t", stats.Expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestRequeueDelayOverMaxDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		deliverIn   time.Duration
+		wantHandled bool
+		wantDelay   time.Duration
+	}{
+		{name: "over max delay is requeued by max delay", deliverIn: 40 * time.Minute, wantDelay: 15 * time.Minute},
+		{name: "within max delay is requeued by remaining delay", deliverIn: 10 * time.Minute, wantDelay: 10 * time.Minute},
+		{name: "delivery time passed is handled", deliverIn: -time.Minute, wantHandled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemoryQueue()
+			requeue := &recordingSender{}
+			srv := NewRPCServer(context.Background(), q, q)
+			srv.SetRequeueSender(requeue)
+			handled := false
+			srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+				"mth": {Name: "mth", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+					handled = true
+					return nil, nil
+				}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+					return nil, nil
+				}},
+			}})
+
+			msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", Payload: []byte("{}"),
+				Timestamp: time.Now().UnixNano(), DeliverAt: time.Now().Add(tt.deliverIn).UnixNano()}
+			if err := q.SendAsyncMsg(msg); err != nil {
+				t.Fatal(err)
+			}
+			received, err := q.ReceiveMsg()
+			if err != nil || len(received) != 1 {
+				t.Fatalf("ReceiveMsg() = %v, %v", received, err)
+			}
+			if err := srv.handleMsg(srv.queues[0], received[0]); err != nil {
+				t.Fatal(err)
+			}
+			if q.Len() != 0 {
+				t.Errorf("message is not deleted from queue")
+			}
+
+			if handled != tt.wantHandled {
+				t.Errorf("handled %t, want %t", handled, tt.wantHandled)
+			}
+			if tt.wantHandled {
+				if len(requeue.msgs) != 0 {
+					t.Errorf("handled message is requeued")
+				}
+				return
+			}
+			if len(requeue.delays) != 1 {
+				t.Fatalf("requeued %d times, want once", len(requeue.delays))
+			}
+			// remaining delay is measured after message is built, so it is slightly shorter
+			if d := requeue.delays[0]; d > tt.wantDelay || d < tt.wantDelay-time.Minute {
+				t.Errorf("requeued with delay %s, want %s", d, tt.wantDelay)
+			}
+			if requeue.msgs[0].DeliverAt != msg.DeliverAt {
+				t.Errorf("delivery time of requeued message is changed")
+			}
+		})
+	}
+}
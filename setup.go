@@ -0,0 +1,289 @@
+package myrpc
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// NewRPCServerFromConf returns RPC server that receives messages from server queue of given config,
+// and from other queues of conf.Server.Queues and priority lanes,
+// with concurrency, retry policy and dead letter queue from config.
+// Queues are provisioned first if conf.Provision is set.
+// Admin server is not started, call StartAdmin with conf.Server.Admin if needed.
+func NewRPCServerFromConf(ctx context.Context, conf *Config) (*RPCServer, error) {
+	if conf.Server.Queue == "" {
+		return nil, ValidationErrors{{Path: "server.queue", Msg: "is required"}}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if err := provisionQueues(ctx, conf); err != nil {
+		return nil, err
+	}
+
+	srv := NewRPCServer(ctx, nil, nil)
+	for _, name := range conf.ServerQueues() {
+		if err := addQueueFromConf(ctx, srv, conf, name); err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.Server.Priority.Lanes) > 0 {
+		if err := addPriorityLanesFromConf(ctx, srv, conf); err != nil {
+			return nil, err
+		}
+	}
+	srv.SetConcurrency(conf.Server.Concurrency)
+	srv.SetRetryPolicy(conf.Server.Retry.MaxAttempts)
+	if conf.Server.ExpiredAction != "" {
+		srv.SetExpiredAction(conf.Server.ExpiredAction)
+	}
+	if dc := conf.Server.Dedup; dc.Enabled {
+		srv.UseDedupStore(NewMemoryDedupStore(dc.Size, dc.Retention))
+	}
+
+	if conf.Server.DeadLetterQueue != "" {
+		deadLetter, err := NewSQSSender(ctx, SenderConf{Queue: conf.Queues[conf.Server.DeadLetterQueue]})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot init dead letter sender of server")
+		}
+		srv.SetDeadLetterSender(deadLetter)
+	}
+
+	replySender, err := NewSQSReplySender(ctx, conf.Queues[conf.Server.Queue])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot init reply sender of server")
+	}
+	srv.SetReplySender(replySender)
+
+	return srv, nil
+}
+
+// NewRPCClientFromConf returns RPC client that sends messages to client queue of given config,
+// or to queues of their routes or priorities, with compression from config.
+// Queues are provisioned first if conf.Provision is set.
+func NewRPCClientFromConf(ctx context.Context, conf *Config) (*RPCClient, error) {
+	if conf.Client.Queue == "" {
+		return nil, ValidationErrors{{Path: "client.queue", Msg: "is required"}}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if err := provisionQueues(ctx, conf); err != nil {
+		return nil, err
+	}
+
+	senders := newQueueSenders(ctx, conf)
+	sender, err := senders.get(conf.Client.Queue)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot init sender of client")
+	}
+	if len(conf.Client.Routes) > 0 {
+		if sender, err = routingSenderFromConf(conf, senders, sender); err != nil {
+			return nil, err
+		}
+	}
+	if len(conf.Client.Priorities) > 0 {
+		if sender, err = prioritySenderFromConf(conf, senders, sender); err != nil {
+			return nil, err
+		}
+	}
+
+	client := NewRPCClient(ctx, sender)
+	if len(conf.Topics) > 0 {
+		publisher, err := NewSNSPublisher(ctx, conf.Topics)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot init publisher of client")
+		}
+		client.UsePublisher(publisher)
+	}
+	if conf.Client.ReplyQueue != "" {
+		if err := useReplyQueueFromConf(ctx, client, conf); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Client.Compression != "" {
+		if err := client.UseCompression(conf.Client.Compression, conf.Client.CompressionThreshold); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// useReplyQueueFromConf makes client receive replies from client reply queue of given config
+func useReplyQueueFromConf(ctx context.Context, client *RPCClient, conf *Config) error {
+	queue := conf.Queues[conf.Client.ReplyQueue]
+	receiver, err := NewSQSReceiver(ctx, ReceiverConf{
+		Queue:             queue,
+		NumMsgsPerReceive: sqsMaxMsgsPerReceive,
+		WaitTimeSeconds:   sqsMaxWaitTimeSeconds,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot init reply receiver of client")
+	}
+	deleter, err := NewSQSDeleter(ctx, DeleterConf{Queue: queue})
+	if err != nil {
+		return errors.Wrap(err, "cannot init reply deleter of client")
+	}
+
+	if conf.Client.ReplyTimeout > 0 {
+		client.SetReplyTimeout(conf.Client.ReplyTimeout)
+	}
+	// server sends replies to url of reply queue
+	client.UseReplyQueue(receiver.(*sqsReceiver).queueURL, receiver, deleter)
+
+	return nil
+}
+
+// provisionQueues creates queues of given config and corrects their attributes, if conf.Provision is set
+func provisionQueues(ctx context.Context, conf *Config) error {
+	if !conf.Provision {
+		return nil
+	}
+
+	provisioner, err := NewSQSProvisioner(ctx, conf)
+	if err != nil {
+		return errors.Wrap(err, "cannot init queue provisioner")
+	}
+	if _, err := provisioner.Apply(); err != nil {
+		return errors.Wrap(err, "cannot provision queues")
+	}
+
+	return nil
+}
+
+// addQueueFromConf adds queue of given name to server, with its weight and concurrency from config
+func addQueueFromConf(ctx context.Context, srv *RPCServer, conf *Config, name string) error {
+	receiver, err := NewSQSReceiver(ctx, conf.QueueReceiverConf(name))
+	if err != nil {
+		return errors.Wrapf(err, "cannot init receiver of queue %s", name)
+	}
+	deleter, err := NewSQSDeleter(ctx, DeleterConf{Queue: conf.Queues[name]})
+	if err != nil {
+		return errors.Wrapf(err, "cannot init deleter of queue %s", name)
+	}
+	// delayed messages are re-enqueued to the queue they are received from
+	requeueSender, err := NewSQSSender(ctx, SenderConf{Queue: conf.Queues[name]})
+	if err != nil {
+		return errors.Wrapf(err, "cannot init requeue sender of queue %s", name)
+	}
+
+	opts := []QueueOption{WithQueueRequeueSender(requeueSender)}
+	if qc, ok := conf.Server.Queues[name]; ok {
+		if qc.Weight > 0 {
+			opts = append(opts, WithQueueWeight(qc.Weight))
+		}
+		opts = append(opts, WithQueueConcurrency(qc.Concurrency))
+	}
+	srv.AddQueue(name, receiver, deleter, opts...)
+
+	return nil
+}
+
+// addPriorityLanesFromConf adds priority lanes of given config to server, as one queue named "priority"
+func addPriorityLanesFromConf(ctx context.Context, srv *RPCServer, conf *Config) error {
+	pc := conf.Server.Priority
+	lanes := make([]Lane, len(pc.Lanes))
+	for i, lc := range pc.Lanes {
+		rc := conf.QueueReceiverConf(lc.Queue)
+		// lanes are polled one by one, so they must not wait for messages
+		rc.WaitTimeSeconds = 0
+		receiver, err := NewSQSReceiver(ctx, rc)
+		if err != nil {
+			return errors.Wrapf(err, "cannot init receiver of lane %s", lc.Priority)
+		}
+		deleter, err := NewSQSDeleter(ctx, DeleterConf{Queue: conf.Queues[lc.Queue]})
+		if err != nil {
+			return errors.Wrapf(err, "cannot init deleter of lane %s", lc.Priority)
+		}
+		requeueSender, err := NewSQSSender(ctx, SenderConf{Queue: conf.Queues[lc.Queue]})
+		if err != nil {
+			return errors.Wrapf(err, "cannot init requeue sender of lane %s", lc.Priority)
+		}
+		lanes[i] = Lane{
+			Priority: lc.Priority,
+			Receiver: receiver,
+			Deleter:  deleter,
+			Requeue:  requeueSender,
+			Weight:   lc.Weight,
+		}
+	}
+
+	mode := pc.Mode
+	if mode == "" {
+		mode = PriorityWeighted
+	}
+	pr, err := NewPriorityReceiver(ctx, mode, lanes...)
+	if err != nil {
+		return err
+	}
+	if pc.IdleWait > 0 {
+		pr.SetIdleWait(pc.IdleWait)
+	}
+
+	opts := []QueueOption{WithQueueRequeueSender(pr.RequeueSender()), WithQueueConcurrency(pc.Concurrency)}
+	if pc.Weight > 0 {
+		opts = append(opts, WithQueueWeight(pc.Weight))
+	}
+	srv.AddQueue("priority", pr, pr, opts...)
+
+	return nil
+}
+
+// queueSenders creates senders of queues of config on demand, one per queue
+type queueSenders struct {
+	ctx     context.Context
+	conf    *Config
+	senders map[string]MessageSender
+}
+
+func newQueueSenders(ctx context.Context, conf *Config) *queueSenders {
+	return &queueSenders{ctx: ctx, conf: conf, senders: make(map[string]MessageSender)}
+}
+
+// get returns sender of queue of given name
+func (qs *queueSenders) get(queue string) (MessageSender, error) {
+	if sender, ok := qs.senders[queue]; ok {
+		return sender, nil
+	}
+
+	sender, err := NewSQSSender(qs.ctx, SenderConf{Queue: qs.conf.Queues[queue]})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot init sender of queue %s", queue)
+	}
+	qs.senders[queue] = sender
+
+	return sender, nil
+}
+
+// routingSenderFromConf returns sender that routes messages by client routes of given config,
+// and sends others by given default sender
+func routingSenderFromConf(conf *Config, senders *queueSenders, defaultSender MessageSender) (*RoutingSender, error) {
+	rs := NewRoutingSender(defaultSender)
+	for _, route := range sortedKeys(conf.Client.Routes) {
+		sender, err := senders.get(conf.Client.Routes[route])
+		if err != nil {
+			return nil, err
+		}
+		svr, mth := ParseRoute(route)
+		rs.Route(svr, mth, sender)
+	}
+
+	return rs, nil
+}
+
+// prioritySenderFromConf returns sender that sends messages to lanes by client priorities of given config,
+// and sends others by given default sender
+func prioritySenderFromConf(conf *Config, senders *queueSenders, defaultSender MessageSender) (*PrioritySender, error) {
+	ps := NewPrioritySender(defaultSender)
+	for _, p := range sortedKeys(conf.Client.Priorities) {
+		sender, err := senders.get(conf.Client.Priorities[p])
+		if err != nil {
+			return nil, err
+		}
+		ps.Lane(Priority(p), sender)
+	}
+
+	return ps, nil
+}
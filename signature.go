@@ -0,0 +1,265 @@
+package myrpc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Names of built-in signature algorithms
+const (
+	SignatureHMACSHA256 = "hmac-sha256"
+	SignatureEd25519    = "ed25519"
+)
+
+// Signature is the signature of a message
+type Signature struct {
+	// KeyID is id of the key that message is signed by
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	Value     []byte `json:"value"`
+}
+
+// Signer is the interface to sign messages on client side
+type Signer interface {
+	// Sign returns signature of given data
+	Sign(data []byte) (*Signature, error)
+}
+
+// Verifier is the interface to verify signature of messages on server side
+type Verifier interface {
+	// Algorithm returns name of the signature algorithm that verifier supports
+	Algorithm() string
+	// Verify returns error if signature of given data is invalid
+	Verify(data []byte, sig *Signature) error
+}
+
+// signMsg signs all fields of message, except the signature itself
+func signMsg(msg *RPCMessage, signer Signer) error {
+	sig, err := signer.Sign(signingBytes(msg))
+	if err != nil {
+		return errors.Wrapf(err, "cannot sign msg of %s/%s", msg.SvrName, msg.MthName)
+	}
+	msg.Signature = sig
+
+	return nil
+}
+
+// verifyMsg verifies signature of message,
+// and checks that message was sent within replay window if window is positive
+func verifyMsg(msg *RPCMessage, verifier Verifier, replayWindow time.Duration) error {
+	if msg.Signature == nil {
+		return errors.New("unsigned message")
+	}
+	if err := verifier.Verify(signingBytes(msg), msg.Signature); err != nil {
+		return errors.Wrapf(err, "invalid signature by key %s", msg.Signature.KeyID)
+	}
+
+	// delayed message that arrives early is requeued and verified again when it is due,
+	// as SQS delivers message delayed over its maximum delay early
+	if replayWindow > 0 && msg.remainingDelay() <= 0 {
+		// delayed message is considered sent at its delivery time
+		sentAt := msg.Timestamp
+		if msg.DeliverAt > sentAt {
+			sentAt = msg.DeliverAt
+		}
+		age := time.Since(time.Unix(0, sentAt))
+		if age > replayWindow || age < -replayWindow {
+			return errors.Errorf("message was sent out of replay window: %s", age)
+		}
+	}
+
+	return nil
+}
+
+// signingBytes returns canonical form of message to be signed.
+// Each field is written with its length, so fields cannot be shifted into each other.
+func signingBytes(msg *RPCMessage) []byte {
+	var buf bytes.Buffer
+	writeField := func(b []byte) {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+		buf.Write(l[:])
+		buf.Write(b)
+	}
+	writeInt := func(i int64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		writeField(b[:])
+	}
+
+	writeField([]byte("myrpc-v1"))
+	writeField([]byte(msg.ID))
+	writeField([]byte(msg.SvrName))
+	writeField([]byte(msg.MthName))
+	writeField(msg.Payload)
+	writeField([]byte(msg.PayloadRef))
+	writeField(msg.PayloadDigest)
+	writeField([]byte(msg.Compression))
+	if msg.Encryption != nil {
+		writeField([]byte(msg.Encryption.KeyID))
+		writeField(msg.Encryption.WrappedKey)
+		writeField(msg.Encryption.Nonce)
+	} else {
+		writeField(nil)
+		writeField(nil)
+		writeField(nil)
+	}
+	writeField([]byte(msg.GroupID))
+	writeField([]byte(msg.DedupID))
+	writeInt(msg.DeliverAt)
+	writeField([]byte(msg.Priority))
+	writeField([]byte(msg.Topic))
+	writeField([]byte(msg.ReplyTo))
+	writeField([]byte(msg.CorrelationID))
+	writeField([]byte(msg.ReplyError))
+	writeInt(msg.Deadline)
+	writeInt(msg.Timestamp)
+
+	keys := make([]string, 0, len(msg.Metadata))
+	for k := range msg.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeInt(int64(len(keys)))
+	for _, k := range keys {
+		writeField([]byte(k))
+		writeField([]byte(msg.Metadata[k]))
+	}
+
+	return buf.Bytes()
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner returns a signer by HMAC-SHA256 with given key
+func NewHMACSigner(keyID string, key []byte) Signer {
+	return &hmacSigner{keyID: keyID, key: key}
+}
+
+func (s *hmacSigner) Sign(data []byte) (*Signature, error) {
+	return &Signature{
+		KeyID:     s.keyID,
+		Algorithm: SignatureHMACSHA256,
+		Value:     hmacSHA256(s.key, data),
+	}, nil
+}
+
+type hmacVerifier struct {
+	keys map[string][]byte
+}
+
+// NewHMACVerifier returns a verifier by HMAC-SHA256 with given keys by their id.
+// All given keys are active, so keys could be rotated without dropping messages.
+func NewHMACVerifier(keys map[string][]byte) Verifier {
+	return &hmacVerifier{keys: keys}
+}
+
+func (v *hmacVerifier) Algorithm() string {
+	return SignatureHMACSHA256
+}
+
+func (v *hmacVerifier) Verify(data []byte, sig *Signature) error {
+	if sig.Algorithm != SignatureHMACSHA256 {
+		return errors.Errorf("unsupported signature algorithm: %s", sig.Algorithm)
+	}
+	key, ok := v.keys[sig.KeyID]
+	if !ok {
+		return errors.Errorf("unknown key: %s", sig.KeyID)
+	}
+	if !hmac.Equal(hmacSHA256(key, data), sig.Value) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns a signer by Ed25519 with given private key
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, key: key}
+}
+
+func (s *ed25519Signer) Sign(data []byte) (*Signature, error) {
+	return &Signature{
+		KeyID:     s.keyID,
+		Algorithm: SignatureEd25519,
+		Value:     ed25519.Sign(s.key, data),
+	}, nil
+}
+
+type ed25519Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// NewEd25519Verifier returns a verifier by Ed25519 with given public keys by their id.
+// All given keys are active, so keys could be rotated without dropping messages.
+func NewEd25519Verifier(keys map[string]ed25519.PublicKey) Verifier {
+	return &ed25519Verifier{keys: keys}
+}
+
+func (v *ed25519Verifier) Algorithm() string {
+	return SignatureEd25519
+}
+
+func (v *ed25519Verifier) Verify(data []byte, sig *Signature) error {
+	if sig.Algorithm != SignatureEd25519 {
+		return errors.Errorf("unsupported signature algorithm: %s", sig.Algorithm)
+	}
+	key, ok := v.keys[sig.KeyID]
+	if !ok {
+		return errors.Errorf("unknown key: %s", sig.KeyID)
+	}
+	if !ed25519.Verify(key, data, sig.Value) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+type multiVerifier struct {
+	verifiers map[string]Verifier
+}
+
+// NewMultiVerifier returns a verifier that verifies signature
+// by the given verifier of the same algorithm
+func NewMultiVerifier(verifiers ...Verifier) Verifier {
+	mv := &multiVerifier{verifiers: make(map[string]Verifier, len(verifiers))}
+	for _, v := range verifiers {
+		mv.verifiers[v.Algorithm()] = v
+	}
+
+	return mv
+}
+
+func (mv *multiVerifier) Algorithm() string {
+	return ""
+}
+
+func (mv *multiVerifier) Verify(data []byte, sig *Signature) error {
+	v, ok := mv.verifiers[sig.Algorithm]
+	if !ok {
+		return errors.Errorf("unsupported signature algorithm: %s", sig.Algorithm)
+	}
+
+	return v.Verify(data, sig)
+}
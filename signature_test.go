@@ -0,0 +1,109 @@
+package myrpc
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyDelayedMsgArrivingEarly(t *testing.T) {
+	signer := NewHMACSigner("k1", []byte("secret"))
+	verifier := NewHMACVerifier(map[string][]byte{"k1": []byte("secret")})
+
+	// delayed over maximum delay of SQS, so it arrives long before it is due
+	msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", Timestamp: time.Now().UnixNano(),
+		DeliverAt: time.Now().Add(time.Hour).UnixNano()}
+	if err := signMsg(msg, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMsg(msg, verifier, time.Minute); err != nil {
+		t.Fatalf("delayed message arriving early is rejected: %v", err)
+	}
+
+	// once due, it is checked against replay window from its delivery time
+	msg.Timestamp = time.Now().Add(-2 * time.Hour).UnixNano()
+	msg.DeliverAt = time.Now().Add(-time.Hour).UnixNano()
+	if err := signMsg(msg, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMsg(msg, verifier, time.Minute); err == nil {
+		t.Fatal("message delivered out of replay window is accepted")
+	}
+}
+
+// recordingSender records sent messages, with delayed delivery
+type recordingSender struct {
+	msgs   []*RPCMessage
+	delays []time.Duration
+}
+
+func (s *recordingSender) SendAsyncMsg(msg *RPCMessage) error {
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func (s *recordingSender) SendSyncMsg(in *RPCMessage, out interface{}) error {
+	return s.SendAsyncMsg(in)
+}
+
+func (s *recordingSender) SendDelayedMsg(msg *RPCMessage, delay time.Duration) error {
+	s.delays = append(s.delays, delay)
+	return s.SendAsyncMsg(msg)
+}
+
+func (s *recordingSender) MaxDelay() time.Duration {
+	return 15 * time.Minute
+}
+
+func TestRequeueSignedDelayedMsg(t *testing.T) {
+	q := NewMemoryQueue()
+	requeue := &recordingSender{}
+	srv := NewRPCServer(context.Background(), q, nil)
+	srv.UseVerifier(NewHMACVerifier(map[string][]byte{"k1": []byte("secret")}), time.Minute)
+	srv.SetRequeueSender(requeue)
+	srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+		"mth": {Name: "mth"},
+	}})
+
+	msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", Timestamp: time.Now().UnixNano(),
+		DeliverAt: time.Now().Add(time.Hour).UnixNano()}
+	if err := signMsg(msg, NewHMACSigner("k1", []byte("secret"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.handleMsg(srv.queues[0], msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(requeue.msgs) != 1 || requeue.msgs[0].ID != msg.ID {
+		t.Fatalf("delayed message is not requeued: %+v", requeue.msgs)
+	}
+}
+
+func TestOffloadedPayloadDigest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := NewFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRPCClient(context.Background(), NewMemoryQueue())
+	c.UseBlobStore(store, 10)
+	msg, err := c.newRPCMsg(context.Background(), "svc", "mth", strings.Repeat("a", 100), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewRPCServer(context.Background(), nil, nil)
+	srv.UseBlobStore(store)
+	if _, err := srv.fetchPayload(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.PutBlob(msg.PayloadRef, []byte(`"replaced"`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.fetchPayload(msg); err == nil {
+		t.Fatal("replaced payload is accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package myrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/pkg/errors"
+)
+
+type snsTopic struct {
+	sns  *sns.SNS
+	conf TopicConf
+}
+
+type snsPublisher struct {
+	ctx    context.Context
+	topics map[string]snsTopic
+}
+
+// NewSNSPublisher returns publisher to SNS topics of given config, by their name.
+// Consumer groups are SQS queues subscribed to the topic, with raw message delivery or not.
+func NewSNSPublisher(ctx context.Context, topics map[string]TopicConf) (Publisher, error) {
+	p := &snsPublisher{ctx: ctx, topics: make(map[string]snsTopic, len(topics))}
+	for name, conf := range topics {
+		sess, err := newAWSSession(conf.Region, conf.AWSAccessKeyID, conf.AWSSecretAccessKey, conf.SessionToken, conf.AWSRoleConf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot init sns session of topic %s with config: %+v", name, conf)
+		}
+		p.topics[name] = snsTopic{
+			sns:  sns.New(sess, &aws.Config{Endpoint: aws.String(conf.Endpoint)}),
+			conf: conf,
+		}
+	}
+
+	return p, nil
+}
+
+// Publish publishes message to SNS topic of given name
+func (p *snsPublisher) Publish(topic string, msg *RPCMessage) error {
+	return p.PublishContext(p.ctx, topic, msg)
+}
+
+// PublishContext publishes message to SNS topic of given name within given ctx
+func (p *snsPublisher) PublishContext(ctx context.Context, topic string, msg *RPCMessage) error {
+	if msg == nil {
+		return errors.New("nil msg is given to Publish")
+	}
+	t, ok := p.topics[topic]
+	if !ok {
+		return errors.Errorf("unknown topic %s", topic)
+	}
+
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert msg to json: %+v", msg)
+	}
+
+	input := &sns.PublishInput{
+		Message:  aws.String(msgJSON),
+		TopicArn: aws.String(t.conf.TopicARN),
+	}
+	if _, err := t.sns.PublishWithContext(ctx, input); err != nil {
+		return errors.Wrapf(err, "cannot publish message to topic %s. msg: %+v", topic, msg)
+	}
+
+	return nil
+}
+
+// snsNotification is the envelope of SNS message delivered to SQS without raw message delivery
+type snsNotification struct {
+	Type     string
+	TopicArn string
+	Message  string
+}
+
+// unwrapSNSNotification returns message inside given SQS message body,
+// if it is delivered by SNS without raw message delivery
+func unwrapSNSNotification(body string) string {
+	if !strings.Contains(body, `"TopicArn"`) {
+		return body
+	}
+
+	var n snsNotification
+	if err := json.Unmarshal([]byte(body), &n); err != nil || n.Type != "Notification" || n.Message == "" {
+		return body
+	}
+
+	return n.Message
+}
@@ -0,0 +1,80 @@
+package myrpc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SQLDialect is the flavor of SQL database that SQL stores run on
+type SQLDialect string
+
+// Supported SQL dialects
+const (
+	// SQLite uses ? placeholders, default dialect
+	SQLite SQLDialect = "sqlite"
+	// Postgres uses $n placeholders
+	Postgres SQLDialect = "postgres"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateTable returns error if given table name is not a plain SQL identifier,
+// as it is put into queries as is
+func validateTable(table string) error {
+	if !sqlIdentifier.MatchString(table) {
+		return errors.Errorf("invalid table name %q", table)
+	}
+
+	return nil
+}
+
+// validate returns error if dialect is not supported
+func (d SQLDialect) validate() error {
+	switch d {
+	case SQLite, Postgres:
+		return nil
+	}
+
+	return errors.Errorf("unsupported sql dialect %q", d)
+}
+
+// rebind replaces ? placeholders of query with placeholders of dialect
+func (d SQLDialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+// blobType returns column type of binary data in dialect
+func (d SQLDialect) blobType() string {
+	if d == Postgres {
+		return "BYTEA"
+	}
+
+	return "BLOB"
+}
+
+// serialKey returns column definition of auto increment primary key in dialect
+func (d SQLDialect) serialKey() string {
+	if d == Postgres {
+		return "BIGSERIAL PRIMARY KEY"
+	}
+
+	return "INTEGER PRIMARY KEY AUTOINCREMENT"
+}
@@ -0,0 +1,134 @@
+package myrpc
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDedupTable is the table of SQL dedup store, see SQLDedupConf
+const DefaultDedupTable = "myrpc_dedup"
+
+// SQLDedupConf contains info about SQL dedup store
+type SQLDedupConf struct {
+	// Table is name of table of records, DefaultDedupTable by default. It is created if not exists.
+	Table string
+	// Retention is the time records are kept, DefaultDedupRetention by default
+	Retention time.Duration
+	// PurgeInterval is the minimum time between purges of expired records on Put, Retention by default
+	PurgeInterval time.Duration
+	// Dialect is SQLite by default
+	Dialect SQLDialect
+}
+
+// SQLDedupStore is a DedupStore on a SQL database, shared by all server processes.
+// Expired records are ignored, and purged on Put from time to time, see Purge.
+type SQLDedupStore struct {
+	ctx        context.Context
+	db         *sql.DB
+	conf       SQLDedupConf
+	locker     sync.Mutex
+	lastPurge  time.Time
+	getQuery   string
+	putQuery   string
+	purgeQuery string
+}
+
+// NewSQLDedupStore returns dedup store on given database, and creates its table if not exists.
+// Driver of database is registered by caller, such as a SQLite or Postgres driver.
+func NewSQLDedupStore(ctx context.Context, db *sql.DB, conf SQLDedupConf) (*SQLDedupStore, error) {
+	if conf.Table == "" {
+		conf.Table = DefaultDedupTable
+	}
+	if conf.Retention <= 0 {
+		conf.Retention = DefaultDedupRetention
+	}
+	if conf.PurgeInterval <= 0 {
+		conf.PurgeInterval = conf.Retention
+	}
+	if conf.Dialect == "" {
+		conf.Dialect = SQLite
+	}
+	if err := validateTable(conf.Table); err != nil {
+		return nil, err
+	}
+	if err := conf.Dialect.validate(); err != nil {
+		return nil, err
+	}
+
+	d, t := conf.Dialect, conf.Table
+	s := &SQLDedupStore{
+		ctx:       ctx,
+		db:        db,
+		conf:      conf,
+		lastPurge: time.Now(),
+		getQuery:  d.rebind("SELECT reply, handled_at FROM " + t + " WHERE id = ? AND handled_at > ?"),
+		putQuery: d.rebind("INSERT INTO " + t + " (id, reply, handled_at) VALUES (?, ?, ?)" +
+			" ON CONFLICT (id) DO UPDATE SET reply = excluded.reply, handled_at = excluded.handled_at"),
+		purgeQuery: d.rebind("DELETE FROM " + t + " WHERE handled_at <= ?"),
+	}
+
+	createSQL := "CREATE TABLE IF NOT EXISTS " + t + " (" +
+		"id VARCHAR(64) PRIMARY KEY, reply " + d.blobType() + ", handled_at BIGINT NOT NULL)"
+	if _, err := db.ExecContext(ctx, createSQL); err != nil {
+		return nil, errors.Wrapf(err, "cannot create dedup table %s", t)
+	}
+
+	return s, nil
+}
+
+// Get returns record of handled message of given id, if it is not expired
+func (s *SQLDedupStore) Get(id string) (DedupRecord, bool, error) {
+	var (
+		reply     []byte
+		handledAt int64
+	)
+	expiredAt := time.Now().Add(-s.conf.Retention).UnixNano()
+	err := s.db.QueryRowContext(s.ctx, s.getQuery, id, expiredAt).Scan(&reply, &handledAt)
+	if err == sql.ErrNoRows {
+		return DedupRecord{}, false, nil
+	}
+	if err != nil {
+		return DedupRecord{}, false, errors.Wrapf(err, "cannot get dedup record %s", id)
+	}
+
+	return DedupRecord{Reply: reply, HandledAt: time.Unix(0, handledAt)}, true, nil
+}
+
+// Put records handled message of given id, replacing its expired record if any
+func (s *SQLDedupStore) Put(id string, rec DedupRecord) error {
+	if _, err := s.db.ExecContext(s.ctx, s.putQuery, id, rec.Reply, rec.HandledAt.UnixNano()); err != nil {
+		return errors.Wrapf(err, "cannot put dedup record %s", id)
+	}
+	s.purgeIfDue()
+
+	return nil
+}
+
+// purgeIfDue purges expired records if they were not purged within purge interval
+func (s *SQLDedupStore) purgeIfDue() {
+	s.locker.Lock()
+	purge := time.Since(s.lastPurge) >= s.conf.PurgeInterval
+	if purge {
+		s.lastPurge = time.Now()
+	}
+	s.locker.Unlock()
+	if purge {
+		// records are ignored once expired, so failing to purge them is not an error of Put
+		_, _ = s.Purge()
+	}
+}
+
+// Purge deletes expired records, and returns number of deleted records
+func (s *SQLDedupStore) Purge() (int64, error) {
+	expiredAt := time.Now().Add(-s.conf.Retention).UnixNano()
+	res, err := s.db.ExecContext(s.ctx, s.purgeQuery, expiredAt)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot purge dedup table %s", s.conf.Table)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,92 @@
+package myrpc
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLite opens SQLite database in given dir
+func openSQLite(t *testing.T, dir string) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLDedupStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+
+	s, err := NewSQLDedupStore(context.Background(), db, SQLDedupConf{Retention: time.Minute, PurgeInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get("a"); err != nil || ok {
+		t.Fatalf("record of unhandled msg: %t %v", ok, err)
+	}
+
+	if err := s.Put("a", DedupRecord{Reply: []byte("first"), HandledAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok, err := s.Get("a"); err != nil || !ok || string(rec.Reply) != "first" {
+		t.Fatalf("record is %+v %t %v, want first", rec, ok, err)
+	}
+
+	// expired record is ignored, then replaced
+	if err := s.Put("b", DedupRecord{Reply: []byte("old"), HandledAt: time.Now().Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get("b"); err != nil || ok {
+		t.Fatalf("expired record is returned: %t %v", ok, err)
+	}
+	if err := s.Put("b", DedupRecord{Reply: []byte("new"), HandledAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok, err := s.Get("b"); err != nil || !ok || string(rec.Reply) != "new" {
+		t.Fatalf("record is %+v %t %v, want new", rec, ok, err)
+	}
+
+	if err := s.Put("c", DedupRecord{HandledAt: time.Now().Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Purge(); err != nil || n != 1 {
+		t.Fatalf("purged %d records, %v, want 1", n, err)
+	}
+	if _, ok, err := s.Get("a"); err != nil || !ok {
+		t.Fatalf("record is purged before retention: %t %v", ok, err)
+	}
+}
+
+func TestSQLDedupStoreInvalidTable(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+
+	if _, err := NewSQLDedupStore(context.Background(), db, SQLDedupConf{Table: "dedup; DROP TABLE x"}); err == nil {
+		t.Fatal("invalid table name is accepted")
+	}
+}
+
+func TestSyncReplaySQLDedupStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+
+	s, err := NewSQLDedupStore(context.Background(), db, SQLDedupConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSyncReplay(t, s)
+}
@@ -0,0 +1,124 @@
+package myrpc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultInboxTable is the table of SQL inbox, see SQLInboxConf
+const DefaultInboxTable = "myrpc_inbox"
+
+// SQLInboxConf contains info about SQL inbox
+type SQLInboxConf struct {
+	// Table is name of table of handled messages, DefaultInboxTable by default. It is created if not exists.
+	Table string
+	// Retention is the time handled messages are kept, DefaultDedupRetention by default
+	Retention time.Duration
+	// PurgeInterval is the minimum time between purges of expired records, Retention by default
+	PurgeInterval time.Duration
+	// TxOptions are options of handler transactions, default of database if nil
+	TxOptions *sql.TxOptions
+	// Dialect is SQLite by default
+	Dialect SQLDialect
+}
+
+// SQLInbox is an inbox of handled messages on a SQL database, that is also the database of business data.
+// Handler runs in a transaction of inbox, and handled message is recorded in the same transaction,
+// so effects of a message are committed once: a redelivery, even after server failed to delete message,
+// is skipped, and a duplicate handled concurrently is rolled back and retried, then skipped as a redelivery.
+type SQLInbox struct {
+	records            *SQLDedupStore
+	txOptions          *sql.TxOptions
+	deleteExpiredQuery string
+	insertQuery        string
+}
+
+// txKey is the key of inbox transaction in handler context
+type txKey struct{}
+
+// TxFromContext returns inbox transaction of handler context, see RPCServer.UseInbox.
+// Handler writes business data in the transaction, and must not commit nor roll it back.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// NewSQLInbox returns inbox on given database, and creates its table if not exists.
+// Driver of database is registered by caller, such as a SQLite or Postgres driver.
+func NewSQLInbox(ctx context.Context, db *sql.DB, conf SQLInboxConf) (*SQLInbox, error) {
+	if conf.Table == "" {
+		conf.Table = DefaultInboxTable
+	}
+	records, err := NewSQLDedupStore(ctx, db, SQLDedupConf{
+		Table:         conf.Table,
+		Retention:     conf.Retention,
+		PurgeInterval: conf.PurgeInterval,
+		Dialect:       conf.Dialect,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot init inbox")
+	}
+
+	return &SQLInbox{
+		records:            records,
+		txOptions:          conf.TxOptions,
+		deleteExpiredQuery: records.conf.Dialect.rebind("DELETE FROM " + conf.Table + " WHERE id = ? AND handled_at <= ?"),
+		insertQuery: records.conf.Dialect.rebind("INSERT INTO " + conf.Table + " (id, reply, handled_at) VALUES (?, ?, ?)" +
+			" ON CONFLICT (id) DO NOTHING"),
+	}, nil
+}
+
+// Get returns record of handled message of given id, if it is not expired
+func (in *SQLInbox) Get(id string) (DedupRecord, bool, error) {
+	return in.records.Get(id)
+}
+
+// Purge deletes expired records, and returns number of deleted records
+func (in *SQLInbox) Purge() (int64, error) {
+	return in.records.Purge()
+}
+
+// begin starts transaction of handler within given ctx
+func (in *SQLInbox) begin(ctx context.Context) (*sql.Tx, error) {
+	tx, err := in.records.db.BeginTx(ctx, in.txOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin inbox transaction")
+	}
+
+	return tx, nil
+}
+
+// commit records handled message of given id in given transaction, then commits it.
+// Expired record of the same id is replaced, as it is ignored by Get.
+// It rolls back transaction and returns error if message is already recorded by another transaction.
+func (in *SQLInbox) commit(tx *sql.Tx, id string, reply []byte) error {
+	now := time.Now()
+	expiredAt := now.Add(-in.records.conf.Retention).UnixNano()
+	if _, err := tx.ExecContext(in.records.ctx, in.deleteExpiredQuery, id, expiredAt); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(err, "cannot delete expired record of msg %s in inbox", id)
+	}
+	res, err := tx.ExecContext(in.records.ctx, in.insertQuery, id, reply, now.UnixNano())
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(err, "cannot record handled msg %s in inbox", id)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(err, "cannot record handled msg %s in inbox", id)
+	}
+	if n == 0 {
+		_ = tx.Rollback()
+		return errors.Errorf("msg %s is handled concurrently, its effects are rolled back", id)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "cannot commit inbox transaction of msg %s", id)
+	}
+	in.records.purgeIfDue()
+
+	return nil
+}
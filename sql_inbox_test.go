@@ -0,0 +1,179 @@
+package myrpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingDeleter fails to delete messages given number of times, then deletes them from queue
+type failingDeleter struct {
+	q     *MemoryQueue
+	fails int32
+}
+
+func (d *failingDeleter) DeleteMsg(msg *RPCMessage) error {
+	if atomic.AddInt32(&d.fails, -1) >= 0 {
+		return errors.New("delete failed")
+	}
+
+	return d.q.DeleteMsg(msg)
+}
+
+// waitFor waits until given condition holds, or fails after timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+// inboxTest serves method "svc"/"write" on inbox, which writes its input to table "effects".
+// Server fails to delete messages, and handler fails after writing, as many times as given.
+type inboxTest struct {
+	db    *sql.DB
+	q     *MemoryQueue
+	srv   *RPCServer
+	calls int32
+}
+
+func newInboxTest(ctx context.Context, t *testing.T, dir string, deleteFailures, failures int32) *inboxTest {
+	db := openSQLite(t, dir)
+	if _, err := db.Exec("CREATE TABLE effects (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := NewSQLInbox(ctx, db, SQLInboxConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := &inboxTest{db: db, q: NewMemoryQueue()}
+	it.q.SetVisibilityTimeout(100 * time.Millisecond)
+	it.srv = NewRPCServer(ctx, it.q, &failingDeleter{q: it.q, fails: deleteFailures})
+	it.srv.SetRetryPolicy(5)
+	it.srv.UseInbox(inbox)
+	it.srv.RegisterService(nil, "svc", ServiceDescription{Name: "svc", Methods: map[MethodName]MethodDescription{
+		"write": {Name: "write", Handler: func(ctx context.Context, svc, in interface{}) (interface{}, error) {
+			atomic.AddInt32(&it.calls, 1)
+			tx, ok := TxFromContext(ctx)
+			if !ok {
+				return nil, errors.New("no inbox transaction")
+			}
+			if _, err := tx.Exec("INSERT INTO effects (n) VALUES (?)", *in.(*int)); err != nil {
+				return nil, err
+			}
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				return nil, errors.New("failed after write")
+			}
+			return nil, nil
+		}, DecodeHandle: func(dec PayloadDecodeFnc, data []byte) (interface{}, error) {
+			var in int
+			return &in, dec(data, &in)
+		}},
+	}})
+	go it.srv.Serve()
+
+	return it
+}
+
+func TestSQLInbox(t *testing.T) {
+	tests := []struct {
+		name           string
+		deleteFailures int32
+		failures       int32
+		wantCalls      int32
+	}{
+		{name: "effect and record commit together", wantCalls: 1},
+		{name: "redelivery after delete failure is no-op", deleteFailures: 1, wantCalls: 1},
+		{name: "handler error rolls back effect and record", failures: 2, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			it := newInboxTest(ctx, t, dir, tt.deleteFailures, tt.failures)
+			defer it.db.Close()
+
+			if err := NewRPCClient(ctx, it.q).SendAsyncMsg("svc", "write", 7, nil); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "message deleted", func() bool { return it.q.Len() == 0 })
+			// redelivery of undeleted message would happen by now
+			time.Sleep(200 * time.Millisecond)
+
+			if n := atomic.LoadInt32(&it.calls); n != tt.wantCalls {
+				t.Errorf("handler is called %d times, want %d", n, tt.wantCalls)
+			}
+			if n := countRows(t, it.db, "effects"); n != 1 {
+				t.Errorf("%d effects are committed, want 1", n)
+			}
+			if n := countRows(t, it.db, DefaultInboxTable); n != 1 {
+				t.Errorf("%d messages are recorded, want 1", n)
+			}
+		})
+	}
+}
+
+func TestSQLInboxCommit(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+	ctx := context.Background()
+	if _, err := db.Exec("CREATE TABLE effects (n INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := NewSQLInbox(ctx, db, SQLInboxConf{Retention: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inbox.records.Put("expired", DedupRecord{HandledAt: time.Now().Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inbox.records.Put("handled", DedupRecord{HandledAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(id string) error {
+		tx, err := inbox.begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("INSERT INTO effects (n) VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+		return inbox.commit(tx, id, []byte(id))
+	}
+
+	if err := commit("expired"); err != nil {
+		t.Errorf("message of expired record is not recorded: %v", err)
+	}
+	if rec, ok, err := inbox.Get("expired"); err != nil || !ok || string(rec.Reply) != "expired" {
+		t.Errorf("expired record is not replaced: %+v %t %v", rec, ok, err)
+	}
+	if err := commit("handled"); err == nil {
+		t.Error("message recorded by another transaction is committed")
+	}
+	if n := countRows(t, db, "effects"); n != 1 {
+		t.Errorf("%d effects are committed, want 1", n)
+	}
+}
@@ -0,0 +1,274 @@
+package myrpc
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of SQL outbox, see SQLOutboxConf
+const (
+	DefaultOutboxTable        = "myrpc_outbox"
+	DefaultOutboxBatchSize    = 100
+	DefaultOutboxPollInterval = time.Second
+	DefaultOutboxRetryWait    = time.Second
+	DefaultOutboxRetention    = 24 * time.Hour
+)
+
+// SQLOutboxConf contains info about SQL outbox
+type SQLOutboxConf struct {
+	// Table is name of table of messages, DefaultOutboxTable by default. It is created if not exists.
+	Table string
+	// BatchSize is the maximum number of messages relay reads at once, DefaultOutboxBatchSize by default
+	BatchSize int
+	// PollInterval is the time relay waits when there is no pending message, DefaultOutboxPollInterval by default
+	PollInterval time.Duration
+	// RetryWait is the time relay waits after failing to send a message, DefaultOutboxRetryWait by default
+	RetryWait time.Duration
+	// MaxAttempts is the number of sends of a message before relay skips it, 0 means retry forever
+	MaxAttempts int
+	// Retention is the time sent messages are kept, DefaultOutboxRetention by default
+	Retention time.Duration
+	// Dialect is SQLite by default
+	Dialect SQLDialect
+}
+
+// SQLOutbox is a transactional outbox on a SQL database.
+// Messages are written in the transaction of business data by Enqueue,
+// so they are sent if and only if the transaction commits, see Relay.
+type SQLOutbox struct {
+	ctx          context.Context
+	db           *sql.DB
+	conf         SQLOutboxConf
+	logger       Logger
+	signer       Signer
+	locker       sync.Mutex
+	lastPurge    time.Time
+	insertQuery  string
+	pendingQuery string
+	sentQuery    string
+	failedQuery  string
+	purgeQuery   string
+}
+
+// NewSQLOutbox returns outbox on given database, and creates its table if not exists.
+// Driver of database is registered by caller, such as a SQLite or Postgres driver.
+func NewSQLOutbox(ctx context.Context, db *sql.DB, conf SQLOutboxConf) (*SQLOutbox, error) {
+	if conf.Table == "" {
+		conf.Table = DefaultOutboxTable
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = DefaultOutboxBatchSize
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = DefaultOutboxPollInterval
+	}
+	if conf.RetryWait <= 0 {
+		conf.RetryWait = DefaultOutboxRetryWait
+	}
+	if conf.Retention <= 0 {
+		conf.Retention = DefaultOutboxRetention
+	}
+	if conf.Dialect == "" {
+		conf.Dialect = SQLite
+	}
+	if err := validateTable(conf.Table); err != nil {
+		return nil, err
+	}
+	if err := conf.Dialect.validate(); err != nil {
+		return nil, err
+	}
+
+	d, t := conf.Dialect, conf.Table
+	pendingQuery := "SELECT seq, msg FROM " + t + " WHERE sent_at IS NULL"
+	if conf.MaxAttempts > 0 {
+		pendingQuery += " AND attempts < " + strconv.Itoa(conf.MaxAttempts)
+	}
+	o := &SQLOutbox{
+		ctx:          ctx,
+		db:           db,
+		conf:         conf,
+		logger:       NopLogger(),
+		lastPurge:    time.Now(),
+		insertQuery:  d.rebind("INSERT INTO " + t + " (id, msg, created_at) VALUES (?, ?, ?)"),
+		pendingQuery: d.rebind(pendingQuery + " ORDER BY seq LIMIT ?"),
+		sentQuery:    d.rebind("UPDATE " + t + " SET sent_at = ?, attempts = attempts + 1, last_error = NULL WHERE seq = ?"),
+		failedQuery:  d.rebind("UPDATE " + t + " SET attempts = attempts + 1, last_error = ? WHERE seq = ?"),
+		purgeQuery:   d.rebind("DELETE FROM " + t + " WHERE sent_at IS NOT NULL AND sent_at <= ?"),
+	}
+
+	createSQL := []string{
+		"CREATE TABLE IF NOT EXISTS " + t + " (seq " + d.serialKey() + ", id VARCHAR(64) NOT NULL, msg TEXT NOT NULL," +
+			" created_at BIGINT NOT NULL, attempts INTEGER NOT NULL DEFAULT 0, last_error TEXT, sent_at BIGINT)",
+		"CREATE INDEX IF NOT EXISTS " + t + "_pending ON " + t + " (sent_at, seq)",
+	}
+	for _, q := range createSQL {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return nil, errors.Wrapf(err, "cannot create outbox table %s", t)
+		}
+	}
+
+	return o, nil
+}
+
+// SetLogger replaces logger of relay, NopLogger by default
+func (o *SQLOutbox) SetLogger(logger Logger) {
+	o.logger = logger
+}
+
+// SetSigner makes relay sign messages again when it sends them, see Relay.
+// It should be the signer of client that enqueues messages, see RPCClient.UseSigner.
+func (o *SQLOutbox) SetSigner(signer Signer) {
+	o.signer = signer
+}
+
+// Enqueue writes message to outbox in given transaction, see RPCClient.SendAsyncMsgTx
+func (o *SQLOutbox) Enqueue(tx *sql.Tx, msg *RPCMessage) error {
+	if msg == nil {
+		return errors.New("nil msg is given to Enqueue")
+	}
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert msg to json: %+v", msg)
+	}
+	if _, err := tx.ExecContext(o.ctx, o.insertQuery, msg.ID, msgJSON, time.Now().UnixNano()); err != nil {
+		return errors.Wrapf(err, "cannot enqueue msg to outbox %s. msg: %+v", o.conf.Table, msg)
+	}
+
+	return nil
+}
+
+// Relay sends pending messages of outbox by given sender in order they were enqueued, until ctx is done.
+// Timestamp of message is set to time of relay, and message is signed again by signer of outbox if any,
+// so replay window and TTL on server count from relay, not from enqueue.
+// A message that cannot be sent is retried before any later message, so order is kept,
+// unless it is skipped after MaxAttempts. Message is sent at least once: if it cannot be marked sent,
+// it is sent again, with the same ID for dedup on server, see RPCServer.UseDedupStore.
+// Run one relay per outbox table to keep order.
+func (o *SQLOutbox) Relay(ctx context.Context, sender MessageSender) {
+	for ctx.Err() == nil {
+		n, err := o.relayPending(ctx, sender)
+		wait := time.Duration(0)
+		if err != nil {
+			o.logger.Error("cannot relay outbox", Field{Key: "table", Value: o.conf.Table}, errField(err))
+			wait = o.conf.RetryWait
+		} else if n < o.conf.BatchSize {
+			o.purgeIfDue()
+			wait = o.conf.PollInterval
+		}
+		if wait == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+type outboxRow struct {
+	seq int64
+	msg string
+}
+
+// relayPending sends a batch of pending messages in order, and returns number of messages sent.
+// It stops at the first message that cannot be sent.
+func (o *SQLOutbox) relayPending(ctx context.Context, sender MessageSender) (int, error) {
+	rows, err := o.pendingRows(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, row := range rows {
+		msg, err := JSONToRPCMsg(row.msg)
+		if err == nil {
+			err = o.stamp(msg)
+		}
+		if err == nil {
+			err = sendMsgContext(ctx, sender, msg)
+		}
+		if err != nil {
+			if _, ferr := o.db.ExecContext(ctx, o.failedQuery, err.Error(), row.seq); ferr != nil {
+				o.logger.Error("cannot record failure of outbox msg", Field{Key: "seq", Value: row.seq}, errField(ferr))
+			}
+			return i, errors.Wrapf(err, "cannot send outbox msg %d", row.seq)
+		}
+
+		if _, err := o.db.ExecContext(ctx, o.sentQuery, time.Now().UnixNano(), row.seq); err != nil {
+			return i, errors.Wrapf(err, "cannot mark outbox msg %d sent", row.seq)
+		}
+		o.logger.Debug("relayed message", msgFields(msg, Field{Key: "seq", Value: row.seq})...)
+	}
+
+	return len(rows), nil
+}
+
+// stamp sets timestamp of message to now and signs it by signer of outbox.
+// Message signed on enqueue is sent as it is without signer, as it cannot be signed again.
+func (o *SQLOutbox) stamp(msg *RPCMessage) error {
+	if o.signer == nil {
+		if msg.Signature == nil {
+			msg.Timestamp = time.Now().UnixNano()
+		}
+		return nil
+	}
+
+	msg.Timestamp = time.Now().UnixNano()
+	return signMsg(msg, o.signer)
+}
+
+// pendingRows reads a batch of pending messages, before sending any of them
+func (o *SQLOutbox) pendingRows(ctx context.Context) ([]outboxRow, error) {
+	rows, err := o.db.QueryContext(ctx, o.pendingQuery, o.conf.BatchSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read outbox %s", o.conf.Table)
+	}
+	defer rows.Close()
+
+	var pending []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.seq, &row.msg); err != nil {
+			return nil, errors.Wrapf(err, "cannot read outbox %s", o.conf.Table)
+		}
+		pending = append(pending, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read outbox %s", o.conf.Table)
+	}
+
+	return pending, nil
+}
+
+// purgeIfDue purges sent messages if they were not purged within retention
+func (o *SQLOutbox) purgeIfDue() {
+	o.locker.Lock()
+	purge := time.Since(o.lastPurge) >= o.conf.Retention
+	if purge {
+		o.lastPurge = time.Now()
+	}
+	o.locker.Unlock()
+	if !purge {
+		return
+	}
+	if _, err := o.Purge(); err != nil {
+		o.logger.Error("cannot purge outbox", Field{Key: "table", Value: o.conf.Table}, errField(err))
+	}
+}
+
+// Purge deletes messages sent before retention, and returns number of deleted messages.
+// Messages skipped after MaxAttempts are kept.
+func (o *SQLOutbox) Purge() (int64, error) {
+	sentBefore := time.Now().Add(-o.conf.Retention).UnixNano()
+	res, err := o.db.ExecContext(o.ctx, o.purgeQuery, sentBefore)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot purge outbox %s", o.conf.Table)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,297 @@
+package myrpc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySender fails to send messages of given payloads given number of times, then sends them to queue
+type flakySender struct {
+	q        *MemoryQueue
+	locker   sync.Mutex
+	failures map[string]int
+	attempts map[string]int
+}
+
+func newFlakySender(q *MemoryQueue, failures map[string]int) *flakySender {
+	return &flakySender{q: q, failures: failures, attempts: make(map[string]int)}
+}
+
+func (s *flakySender) SendAsyncMsg(msg *RPCMessage) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	payload := string(msg.Payload)
+	s.attempts[payload]++
+	if s.failures[payload] < 0 || s.attempts[payload] <= s.failures[payload] {
+		return errors.New("send failed")
+	}
+
+	return s.q.SendAsyncMsg(msg)
+}
+
+func (s *flakySender) SendSyncMsg(in *RPCMessage, out interface{}) error {
+	return s.SendAsyncMsg(in)
+}
+
+func (s *flakySender) attemptsOf(payload string) int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.attempts[payload]
+}
+
+// receiveAll receives n messages from given queue, or fails after timeout
+func receiveAll(t *testing.T, q *MemoryQueue, n int) []*RPCMessage {
+	var msgs []*RPCMessage
+	deadline := time.Now().Add(5 * time.Second)
+	for len(msgs) < n && time.Now().Before(deadline) {
+		received, err := q.ReceiveMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range received {
+			msgs = append(msgs, msg)
+			if err := q.DeleteMsg(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(received) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if len(msgs) != n {
+		t.Fatalf("received %d messages, want %d", len(msgs), n)
+	}
+
+	return msgs
+}
+
+func payloadsOf(msgs []*RPCMessage) string {
+	payloads := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		payloads = append(payloads, string(msg.Payload))
+	}
+
+	return strings.Join(payloads, ",")
+}
+
+// rawEncode encodes string input as it is, so payload of messages is readable in tests
+func rawEncode(in interface{}) ([]byte, error) {
+	return []byte(in.(string)), nil
+}
+
+func TestSQLOutboxRelay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outbox, err := NewSQLOutbox(ctx, db, SQLOutboxConf{BatchSize: 3, PollInterval: 10 * time.Millisecond, RetryWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewMemoryQueue()
+	c := NewRPCClient(ctx, q)
+	c.UseOutbox(outbox)
+
+	// messages of two groups, and a rolled back one
+	enqueued := []struct {
+		payload  string
+		group    string
+		rollback bool
+	}{
+		{"a1", "a", false}, {"b1", "b", false}, {"a2", "a", false}, {"rolled-back", "a", true},
+		{"b2", "b", false}, {"a3", "a", false}, {"b3", "b", false},
+	}
+	for _, e := range enqueued {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SendAsyncMsgTx(tx, "svc", "mth", e.payload, rawEncode, WithMessageGroupID(e.group)); err != nil {
+			t.Fatal(err)
+		}
+		if e.rollback {
+			err = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender := newFlakySender(q, map[string]int{"a2": 2, "b2": 1})
+	go outbox.Relay(ctx, sender)
+	msgs := receiveAll(t, q, 6)
+
+	if got := payloadsOf(msgs); got != "a1,b1,a2,b2,a3,b3" {
+		t.Errorf("relayed %s, want in order of enqueue without rolled back message", got)
+	}
+	groups := map[string][]*RPCMessage{}
+	for _, msg := range msgs {
+		groups[msg.GroupID] = append(groups[msg.GroupID], msg)
+	}
+	if got := payloadsOf(groups["a"]); got != "a1,a2,a3" {
+		t.Errorf("relayed group a %s, want a1,a2,a3", got)
+	}
+	if got := payloadsOf(groups["b"]); got != "b1,b2,b3" {
+		t.Errorf("relayed group b %s, want b1,b2,b3", got)
+	}
+	if n := sender.attemptsOf("rolled-back"); n != 0 {
+		t.Errorf("rolled back message is relayed %d times", n)
+	}
+	if n := sender.attemptsOf("a2"); n != 3 {
+		t.Errorf("failed message is sent %d times, want 3", n)
+	}
+}
+
+func TestSQLOutboxMaxAttempts(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outbox, err := NewSQLOutbox(ctx, db, SQLOutboxConf{MaxAttempts: 2, PollInterval: 10 * time.Millisecond, RetryWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewMemoryQueue()
+	c := NewRPCClient(ctx, q)
+	c.UseOutbox(outbox)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"poison", "next"} {
+		if err := c.SendAsyncMsgTx(tx, "svc", "mth", payload, rawEncode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := newFlakySender(q, map[string]int{"poison": -1})
+	go outbox.Relay(ctx, sender)
+	if got := payloadsOf(receiveAll(t, q, 1)); got != "next" {
+		t.Errorf("relayed %s, want next", got)
+	}
+	// relay keeps polling, but does not send skipped message again
+	time.Sleep(100 * time.Millisecond)
+	if n := sender.attemptsOf("poison"); n != 2 {
+		t.Errorf("message is sent %d times, want 2", n)
+	}
+
+	var attempts int
+	var sentAt *int64
+	// poison message is enqueued first
+	row := db.QueryRow("SELECT attempts, sent_at FROM " + DefaultOutboxTable + " ORDER BY seq LIMIT 1")
+	if err := row.Scan(&attempts, &sentAt); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || sentAt != nil {
+		t.Errorf("skipped message has %d attempts, sent at %v, want 2 attempts and not sent", attempts, sentAt)
+	}
+}
+
+func TestSQLOutboxStampsAtRelay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signer, verifier := NewHMACSigner("k1", []byte("secret")), NewHMACVerifier(map[string][]byte{"k1": []byte("secret")})
+	enqueuedAt := time.Now().Add(-time.Hour).UnixNano()
+	tests := []struct {
+		name       string
+		signer     Signer
+		signed     bool
+		wantFresh  bool
+		wantVerify bool
+	}{
+		{name: "signed again by signer of outbox", signer: signer, signed: true, wantFresh: true, wantVerify: true},
+		{name: "unsigned is signed by signer of outbox", signer: signer, wantFresh: true, wantVerify: true},
+		{name: "unsigned without signer", wantFresh: true},
+		{name: "signed without signer is sent as it is", signed: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outbox, err := NewSQLOutbox(ctx, db, SQLOutboxConf{Table: "outbox_" + string(rune('a'+i)), PollInterval: 10 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			outbox.SetSigner(tt.signer)
+
+			// message enqueued long before relay, such as while relay was down
+			msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", Payload: []byte("late"), Timestamp: enqueuedAt}
+			if tt.signed {
+				if err := signMsg(msg, signer); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := outbox.Enqueue(tx, msg); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			q := NewMemoryQueue()
+			relayCtx, stopRelay := context.WithCancel(ctx)
+			defer stopRelay()
+			go outbox.Relay(relayCtx, q)
+			relayed := receiveAll(t, q, 1)[0]
+
+			if fresh := time.Since(time.Unix(0, relayed.Timestamp)) < time.Minute; fresh != tt.wantFresh {
+				t.Errorf("timestamp is %s ago", time.Since(time.Unix(0, relayed.Timestamp)))
+			}
+			if err := verifyMsg(relayed, verifier, time.Minute); (err == nil) != tt.wantVerify {
+				t.Errorf("verifyMsg() error = %v, want verified %t", err, tt.wantVerify)
+			}
+		})
+	}
+}
+
+func TestSendAsyncMsgTxRequiresSignerOfOutbox(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := openSQLite(t, dir)
+	defer db.Close()
+
+	outbox, err := NewSQLOutbox(context.Background(), db, SQLOutboxConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRPCClient(context.Background(), NewMemoryQueue())
+	c.UseOutbox(outbox)
+	c.UseSigner(NewHMACSigner("k1", []byte("secret")))
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if err := c.SendAsyncMsgTx(tx, "svc", "mth", "payload", rawEncode); err == nil {
+		t.Fatal("signing client enqueues message to outbox without signer")
+	}
+	outbox.SetSigner(NewHMACSigner("k1", []byte("secret")))
+	if err := c.SendAsyncMsgTx(tx, "svc", "mth", "payload", rawEncode); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,21 +2,29 @@ package myrpc
 
 import (
 	"context"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/pkg/errors"
 )
 
+// fifoQueueSuffix is the required suffix of SQS FIFO queue name
+const fifoQueueSuffix = ".fifo"
+
+// isFIFO reports whether the queue is a FIFO queue, based on its name
+func (conf QueueConf) isFIFO() bool {
+	return strings.HasSuffix(conf.QueueName, fifoQueueSuffix)
+}
+
 func newSQSClient(ctx context.Context, conf QueueConf) (client *sqs.SQS, queueURL string, err error) {
 	sqsSession, err := initSQSSession(conf)
 	if err != nil {
 		return nil, "", errors.Wrapf(err, "cannot init sqs session with config: %+v", conf)
 	}
 
-	client = sqs.New(sqsSession)
+	client = newSQSService(sqsSession, conf)
 	queueInfo, err := client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String(conf.QueueName)})
 	if err != nil {
 		return nil, "", errors.Wrapf(err, "cannot get queue url %s", conf.QueueName)
@@ -25,11 +33,11 @@ func newSQSClient(ctx context.Context, conf QueueConf) (client *sqs.SQS, queueUR
 	return client, *queueInfo.QueueUrl, nil
 }
 
+// newSQSService returns SQS service client on endpoint of given conf
+func newSQSService(sess *session.Session, conf QueueConf) *sqs.SQS {
+	return sqs.New(sess, &aws.Config{Endpoint: aws.String(conf.QueueBaseURL)})
+}
+
 func initSQSSession(conf QueueConf) (*session.Session, error) {
-	cred := credentials.NewStaticCredentials(conf.AWSAccessKeyID, conf.AWSSecretAccessKey, conf.SessionToken)
-	return session.New(&aws.Config{
-		Credentials: cred,
-		Region:      aws.String(conf.QueueRegion),
-		Endpoint:    aws.String(conf.QueueBaseURL),
-	}), nil
+	return newAWSSession(conf.QueueRegion, conf.AWSAccessKeyID, conf.AWSSecretAccessKey, conf.SessionToken, conf.AWSRoleConf)
 }
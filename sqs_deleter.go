@@ -38,7 +38,7 @@ func (sr *sqsDeleter) DeleteMsg(msg *RPCMessage) error {
 
 	_, err := sr.sqs.DeleteMessageWithContext(sr.ctx, param)
 	if err != nil {
-		return errors.Wrapf(err, "cannot delete message with params. msg: %+v, params: %+v", msg, param)
+		return errors.Wrapf(err, "cannot delete message from queue %s. msg: %+v", sr.conf.Queue.QueueName, msg)
 	}
 
 	return nil
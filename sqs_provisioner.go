@@ -0,0 +1,326 @@
+package myrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+)
+
+// AttributeChange is a planned change of an attribute of queue
+type AttributeChange struct {
+	Name    string
+	Current string
+	Desired string
+}
+
+// QueueChange is a planned change of a queue
+type QueueChange struct {
+	// Queue is name of queue in config
+	Queue     string
+	QueueName string
+	// Create is true if queue does not exist
+	Create     bool
+	Attributes []AttributeChange
+}
+
+// ProvisionPlan contains changes to make queues match config
+type ProvisionPlan struct {
+	Changes []QueueChange
+}
+
+// HasChanges reports whether any queue needs to be changed
+func (p *ProvisionPlan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// String returns changes of plan in human readable format
+func (p *ProvisionPlan) String() string {
+	if !p.HasChanges() {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+	for _, c := range p.Changes {
+		action := "update"
+		if c.Create {
+			action = "create"
+		}
+		fmt.Fprintf(&b, "%s queue %s (%s)\n", action, c.Queue, c.QueueName)
+		for _, a := range c.Attributes {
+			fmt.Fprintf(&b, "  %s: %q -> %q\n", a.Name, a.Current, a.Desired)
+		}
+	}
+
+	return b.String()
+}
+
+// SQSProvisioner creates queues of config, and corrects their attributes
+type SQSProvisioner struct {
+	ctx     context.Context
+	queues  map[string]QueueConf
+	clients map[string]*sqs.SQS
+}
+
+// NewSQSProvisioner returns provisioner of all queues of given config
+func NewSQSProvisioner(ctx context.Context, conf *Config) (*SQSProvisioner, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &SQSProvisioner{
+		ctx:     ctx,
+		queues:  conf.Queues,
+		clients: make(map[string]*sqs.SQS, len(conf.Queues)),
+	}
+	for name, qc := range conf.Queues {
+		sqsSession, err := initSQSSession(qc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot init sqs session of queue %s with config: %+v", name, qc)
+		}
+		p.clients[name] = newSQSService(sqsSession, qc)
+	}
+
+	return p, nil
+}
+
+// Plan returns changes to make queues match config, without changing them
+func (p *SQSProvisioner) Plan() (*ProvisionPlan, error) {
+	return p.provision(false)
+}
+
+// Apply creates missing queues and corrects attributes of existing ones.
+// It returns the changes it made.
+func (p *SQSProvisioner) Apply() (*ProvisionPlan, error) {
+	return p.provision(true)
+}
+
+func (p *SQSProvisioner) provision(apply bool) (*ProvisionPlan, error) {
+	order, err := p.queueOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ProvisionPlan{}
+	// arns of queues, to refer from redrive policy of their source queues
+	arns := make(map[string]string, len(order))
+	for _, name := range order {
+		qc, client := p.queues[name], p.clients[name]
+
+		queueURL, current, err := p.queueAttributes(client, qc.QueueName)
+		if err != nil {
+			return nil, err
+		}
+		exists := queueURL != ""
+
+		dlqArn := ""
+		if dlq := qc.Attributes.DeadLetterQueue; dlq != "" {
+			dlqArn = arns[dlq]
+		}
+		change := diffAttributes(qc, dlqArn, current, exists)
+		change.Queue = name
+		if exists && len(change.Attributes) == 0 {
+			arns[name] = current[sqs.QueueAttributeNameQueueArn]
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+
+		if !apply {
+			// queue does not exist until applying
+			if !exists {
+				arns[name] = fmt.Sprintf("(arn of %s)", qc.QueueName)
+			} else {
+				arns[name] = current[sqs.QueueAttributeNameQueueArn]
+			}
+			continue
+		}
+
+		attrs := make(map[string]*string, len(change.Attributes))
+		for _, a := range change.Attributes {
+			attrs[a.Name] = aws.String(a.Desired)
+		}
+		if !exists {
+			out, err := client.CreateQueueWithContext(p.ctx, &sqs.CreateQueueInput{
+				QueueName:  aws.String(qc.QueueName),
+				Attributes: attrs,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot create queue %s", qc.QueueName)
+			}
+			queueURL = aws.StringValue(out.QueueUrl)
+		} else {
+			_, err := client.SetQueueAttributesWithContext(p.ctx, &sqs.SetQueueAttributesInput{
+				QueueUrl:   aws.String(queueURL),
+				Attributes: attrs,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot set attributes of queue %s", qc.QueueName)
+			}
+		}
+
+		if arns[name], err = p.queueArn(client, queueURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// queueAttributes returns url and all attributes of queue of given name,
+// or empty url if queue does not exist
+func (p *SQSProvisioner) queueAttributes(client *sqs.SQS, queueName string) (string, map[string]string, error) {
+	info, err := client.GetQueueUrlWithContext(p.ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sqs.ErrCodeQueueDoesNotExist {
+			return "", nil, nil
+		}
+		return "", nil, errors.Wrapf(err, "cannot get queue url %s", queueName)
+	}
+
+	out, err := client.GetQueueAttributesWithContext(p.ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       info.QueueUrl,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+	})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "cannot get attributes of queue %s", queueName)
+	}
+
+	return aws.StringValue(info.QueueUrl), aws.StringValueMap(out.Attributes), nil
+}
+
+func (p *SQSProvisioner) queueArn(client *sqs.SQS, queueURL string) (string, error) {
+	out, err := client.GetQueueAttributesWithContext(p.ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get arn of queue %s", queueURL)
+	}
+
+	return aws.StringValue(out.Attributes[sqs.QueueAttributeNameQueueArn]), nil
+}
+
+// queueOrder returns names of queues in config,
+// with dead letter queues before their source queues
+func (p *SQSProvisioner) queueOrder() ([]string, error) {
+	names := make([]string, 0, len(p.queues))
+	for name := range p.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, len(names))
+	visited := make(map[string]bool, len(names))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if visited[name] {
+			return nil
+		}
+		for _, n := range path {
+			if n == name {
+				return errors.Errorf("cycle of dead letter queues: %s", strings.Join(append(path, name), " -> "))
+			}
+		}
+		if dlq := p.queues[name].Attributes.DeadLetterQueue; dlq != "" {
+			if err := visit(dlq, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visited[name] = true
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// diffAttributes returns change of attributes of queue, from current attributes to ones of config.
+// All desired attributes are in the change if queue does not exist.
+// Redrive policy of queue is removed if config has no dead letter queue.
+func diffAttributes(qc QueueConf, dlqArn string, current map[string]string, exists bool) QueueChange {
+	change := QueueChange{QueueName: qc.QueueName, Create: !exists}
+
+	desired := desiredAttributes(qc, dlqArn)
+	if _, ok := desired[sqs.QueueAttributeNameRedrivePolicy]; !ok && current[sqs.QueueAttributeNameRedrivePolicy] != "" {
+		// SQS removes redrive policy that is set to empty
+		desired[sqs.QueueAttributeNameRedrivePolicy] = ""
+	}
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if exists && (name == sqs.QueueAttributeNameFifoQueue || sameAttribute(name, current[name], desired[name])) {
+			// FIFO is decided by queue name, so it cannot drift
+			continue
+		}
+		change.Attributes = append(change.Attributes, AttributeChange{
+			Name:    name,
+			Current: current[name],
+			Desired: desired[name],
+		})
+	}
+
+	return change
+}
+
+// desiredAttributes returns SQS attributes of queue by config
+func desiredAttributes(qc QueueConf, dlqArn string) map[string]string {
+	attrs := qc.Attributes
+	desired := make(map[string]string)
+	if attrs.VisibilityTimeout > 0 {
+		desired[sqs.QueueAttributeNameVisibilityTimeout] = strconv.FormatInt(attrs.VisibilityTimeout, 10)
+	}
+	if attrs.MessageRetentionPeriod > 0 {
+		desired[sqs.QueueAttributeNameMessageRetentionPeriod] = strconv.FormatInt(attrs.MessageRetentionPeriod, 10)
+	}
+	if qc.isFIFO() {
+		desired[sqs.QueueAttributeNameFifoQueue] = "true"
+		desired[sqs.QueueAttributeNameContentBasedDeduplication] = strconv.FormatBool(attrs.ContentBasedDeduplication)
+	}
+	if dlqArn != "" {
+		policy, _ := json.Marshal(redrivePolicy{
+			DeadLetterTargetArn: dlqArn,
+			MaxReceiveCount:     strconv.FormatInt(attrs.MaxReceiveCount, 10),
+		})
+		desired[sqs.QueueAttributeNameRedrivePolicy] = string(policy)
+	}
+
+	return desired
+}
+
+// redrivePolicy is the redrive policy attribute of SQS queue
+type redrivePolicy struct {
+	DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	MaxReceiveCount     string `json:"maxReceiveCount"`
+}
+
+// sameAttribute reports whether given values of attribute are equivalent
+func sameAttribute(name, current, desired string) bool {
+	if name != sqs.QueueAttributeNameRedrivePolicy {
+		return current == desired
+	}
+
+	// maxReceiveCount is returned as number by SQS, but as string by some implementations
+	var c, d map[string]interface{}
+	if json.Unmarshal([]byte(current), &c) != nil || json.Unmarshal([]byte(desired), &d) != nil {
+		return current == desired
+	}
+
+	return fmt.Sprint(c["deadLetterTargetArn"]) == fmt.Sprint(d["deadLetterTargetArn"]) &&
+		fmt.Sprint(c["maxReceiveCount"]) == fmt.Sprint(d["maxReceiveCount"])
+}
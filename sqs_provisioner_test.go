@@ -0,0 +1,324 @@
+package myrpc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const fakeSQSAccount = "123456789012"
+
+// fakeSQS is a fake SQS server of query protocol, that keeps attributes and messages of queues by name
+type fakeSQS struct {
+	*httptest.Server
+	locker   sync.Mutex
+	queues   map[string]map[string]string
+	messages map[string][]fakeSQSMsg
+	actions  []string
+}
+
+// fakeSQSMsg is a message sent to fakeSQS
+type fakeSQSMsg struct {
+	body    string
+	groupID string
+	dedupID string
+	delay   string
+}
+
+func newFakeSQS() *fakeSQS {
+	f := &fakeSQS{queues: make(map[string]map[string]string), messages: make(map[string][]fakeSQSMsg)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// addQueue adds queue of given name and attributes, with its arn
+func (f *fakeSQS) addQueue(name string, attrs map[string]string) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	queue := map[string]string{sqs.QueueAttributeNameQueueArn: f.arn(name)}
+	for k, v := range attrs {
+		queue[k] = v
+	}
+	f.queues[name] = queue
+}
+
+func (f *fakeSQS) arn(name string) string {
+	return "arn:aws:sqs:us-east-1:" + fakeSQSAccount + ":" + name
+}
+
+// queueOf returns name of queue of given url, and its attributes
+func (f *fakeSQS) queueOf(url string) (string, map[string]string) {
+	name := url[strings.LastIndex(url, "/")+1:]
+	return name, f.queues[name]
+}
+
+func (f *fakeSQS) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	action := r.Form.Get("Action")
+	f.actions = append(f.actions, action+" "+r.Form.Get("QueueName")+r.Form.Get("QueueUrl"))
+	queueURL := f.URL + "/" + fakeSQSAccount + "/"
+	switch action {
+	case "GetQueueUrl":
+		name := r.Form.Get("QueueName")
+		if _, ok := f.queues[name]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>no queue</Message></Error></ErrorResponse>",
+				sqs.ErrCodeQueueDoesNotExist)
+			return
+		}
+		fmt.Fprintf(w, "<GetQueueUrlResponse><GetQueueUrlResult><QueueUrl>%s</QueueUrl></GetQueueUrlResult></GetQueueUrlResponse>",
+			queueURL+name)
+	case "GetQueueAttributes":
+		_, attrs := f.queueOf(r.Form.Get("QueueUrl"))
+		fmt.Fprint(w, "<GetQueueAttributesResponse><GetQueueAttributesResult>")
+		for k, v := range attrs {
+			fmt.Fprint(w, "<Attribute><Name>", k, "</Name><Value>")
+			_ = xml.EscapeText(w, []byte(v))
+			fmt.Fprint(w, "</Value></Attribute>")
+		}
+		fmt.Fprint(w, "</GetQueueAttributesResult></GetQueueAttributesResponse>")
+	case "CreateQueue":
+		name := r.Form.Get("QueueName")
+		f.queues[name] = map[string]string{sqs.QueueAttributeNameQueueArn: f.arn(name)}
+		f.setAttributes(name, r)
+		fmt.Fprintf(w, "<CreateQueueResponse><CreateQueueResult><QueueUrl>%s</QueueUrl></CreateQueueResult></CreateQueueResponse>",
+			queueURL+name)
+	case "SetQueueAttributes":
+		name, _ := f.queueOf(r.Form.Get("QueueUrl"))
+		f.setAttributes(name, r)
+		fmt.Fprint(w, "<SetQueueAttributesResponse></SetQueueAttributesResponse>")
+	case "SendMessage":
+		name, _ := f.queueOf(r.Form.Get("QueueUrl"))
+		body := r.Form.Get("MessageBody")
+		f.messages[name] = append(f.messages[name], fakeSQSMsg{body: body, groupID: r.Form.Get("MessageGroupId"),
+			dedupID: r.Form.Get("MessageDeduplicationId"), delay: r.Form.Get("DelaySeconds")})
+		fmt.Fprintf(w, "<SendMessageResponse><SendMessageResult><MessageId>%d</MessageId><MD5OfMessageBody>%x</MD5OfMessageBody>"+
+			"</SendMessageResult></SendMessageResponse>", len(f.messages[name]), md5.Sum([]byte(body)))
+	case "ReceiveMessage":
+		name, _ := f.queueOf(r.Form.Get("QueueUrl"))
+		fmt.Fprint(w, "<ReceiveMessageResponse><ReceiveMessageResult>")
+		for i, msg := range f.messages[name] {
+			fmt.Fprintf(w, "<Message><MessageId>%d</MessageId><ReceiptHandle>%d</ReceiptHandle><MD5OfBody>%x</MD5OfBody><Body>",
+				i, i, md5.Sum([]byte(msg.body)))
+			_ = xml.EscapeText(w, []byte(msg.body))
+			fmt.Fprint(w, "</Body>")
+			if msg.groupID != "" {
+				fmt.Fprintf(w, "<Attribute><Name>%s</Name><Value>%s</Value></Attribute>",
+					sqs.MessageSystemAttributeNameMessageGroupId, msg.groupID)
+			}
+			fmt.Fprint(w, "</Message>")
+		}
+		f.messages[name] = nil
+		fmt.Fprint(w, "</ReceiveMessageResult></ReceiveMessageResponse>")
+	default:
+		http.Error(w, "unsupported action "+action, http.StatusBadRequest)
+	}
+}
+
+// setAttributes sets attributes of request to queue of given name, and removes empty ones as SQS does
+func (f *fakeSQS) setAttributes(name string, r *http.Request) {
+	for i := 1; r.Form.Get(fmt.Sprintf("Attribute.%d.Name", i)) != ""; i++ {
+		k, v := r.Form.Get(fmt.Sprintf("Attribute.%d.Name", i)), r.Form.Get(fmt.Sprintf("Attribute.%d.Value", i))
+		if v == "" {
+			delete(f.queues[name], k)
+		} else {
+			f.queues[name][k] = v
+		}
+	}
+}
+
+func TestDiffAttributes(t *testing.T) {
+	const dlqArn = "arn:aws:sqs:us-east-1:123456789012:dlq"
+	redrive := `{"deadLetterTargetArn":"` + dlqArn + `","maxReceiveCount":"5"}`
+	withDLQ := QueueConf{QueueName: "main", Attributes: QueueAttributesConf{VisibilityTimeout: 30, DeadLetterQueue: "dlq", MaxReceiveCount: 5}}
+	tests := []struct {
+		name    string
+		qc      QueueConf
+		dlqArn  string
+		current map[string]string
+		exists  bool
+		want    []AttributeChange
+	}{
+		{"missing queue", withDLQ, dlqArn, nil, false, []AttributeChange{
+			{Name: sqs.QueueAttributeNameRedrivePolicy, Desired: redrive},
+			{Name: sqs.QueueAttributeNameVisibilityTimeout, Desired: "30"},
+		}},
+		{"missing fifo queue", QueueConf{QueueName: "main.fifo"}, "", nil, false, []AttributeChange{
+			{Name: sqs.QueueAttributeNameContentBasedDeduplication, Desired: "false"},
+			{Name: sqs.QueueAttributeNameFifoQueue, Desired: "true"},
+		}},
+		{"unchanged", withDLQ, dlqArn, map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "30",
+			sqs.QueueAttributeNameRedrivePolicy: `{"deadLetterTargetArn":"` + dlqArn + `","maxReceiveCount":5}`,
+			sqs.QueueAttributeNameDelaySeconds:  "0"}, true, nil},
+		{"unset attribute is left", QueueConf{QueueName: "main"}, "",
+			map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "45"}, true, nil},
+		{"drifted attribute", withDLQ, dlqArn, map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "45",
+			sqs.QueueAttributeNameRedrivePolicy: redrive}, true, []AttributeChange{
+			{Name: sqs.QueueAttributeNameVisibilityTimeout, Current: "45", Desired: "30"},
+		}},
+		{"drifted redrive policy", withDLQ, dlqArn, map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "30",
+			sqs.QueueAttributeNameRedrivePolicy: `{"deadLetterTargetArn":"` + dlqArn + `","maxReceiveCount":10}`}, true, []AttributeChange{
+			{Name: sqs.QueueAttributeNameRedrivePolicy, Current: `{"deadLetterTargetArn":"` + dlqArn + `","maxReceiveCount":10}`, Desired: redrive},
+		}},
+		{"redrive policy not in config", QueueConf{QueueName: "main"}, "",
+			map[string]string{sqs.QueueAttributeNameRedrivePolicy: redrive}, true, []AttributeChange{
+				{Name: sqs.QueueAttributeNameRedrivePolicy, Current: redrive},
+			}},
+		{"fifo does not drift", QueueConf{QueueName: "main.fifo"}, "", map[string]string{
+			sqs.QueueAttributeNameContentBasedDeduplication: "false"}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffAttributes(tt.qc, tt.dlqArn, tt.current, tt.exists)
+			if got.QueueName != tt.qc.QueueName || got.Create != !tt.exists {
+				t.Errorf("diffAttributes() = %+v, want queue %s created %v", got, tt.qc.QueueName, !tt.exists)
+			}
+			if !reflect.DeepEqual(got.Attributes, tt.want) {
+				t.Errorf("attributes of diffAttributes() = %+v, want %+v", got.Attributes, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	dlqOf := func(dlq string) QueueConf {
+		return QueueConf{Attributes: QueueAttributesConf{DeadLetterQueue: dlq}}
+	}
+	tests := []struct {
+		name    string
+		queues  map[string]QueueConf
+		want    []string
+		wantErr bool
+	}{
+		{"sorted without dead letter queues", map[string]QueueConf{"c": {}, "a": {}, "b": {}}, []string{"a", "b", "c"}, false},
+		{"dead letter queue first", map[string]QueueConf{"a": dlqOf("z"), "z": {}}, []string{"z", "a"}, false},
+		{"chain of dead letter queues", map[string]QueueConf{"a": dlqOf("b"), "b": dlqOf("c"), "c": {}, "d": dlqOf("c")},
+			[]string{"c", "b", "a", "d"}, false},
+		{"shared dead letter queue", map[string]QueueConf{"a": dlqOf("dlq"), "b": dlqOf("dlq"), "dlq": {}},
+			[]string{"dlq", "a", "b"}, false},
+		{"cycle", map[string]QueueConf{"a": dlqOf("b"), "b": dlqOf("a")}, nil, true},
+		{"self", map[string]QueueConf{"a": dlqOf("a")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &SQSProvisioner{queues: tt.queues}
+			got, err := p.queueOrder()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queueOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queueOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestProvisioner(t *testing.T, fake *fakeSQS, queues map[string]QueueConf) *SQSProvisioner {
+	t.Helper()
+	for name, qc := range queues {
+		qc.QueueRegion, qc.QueueBaseURL = "us-east-1", fake.URL
+		qc.AWSAccessKeyID, qc.AWSSecretAccessKey = "key", "secret"
+		queues[name] = qc
+	}
+	p, err := NewSQSProvisioner(context.Background(), &Config{Queues: queues})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestProvisionPlan(t *testing.T) {
+	fake := newFakeSQS()
+	defer fake.Close()
+	fake.addQueue("unchanged", map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "30"})
+	fake.addQueue("drifted", map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "45",
+		sqs.QueueAttributeNameRedrivePolicy: `{"deadLetterTargetArn":"` + fake.arn("old") + `","maxReceiveCount":3}`})
+
+	p := newTestProvisioner(t, fake, map[string]QueueConf{
+		"a-main":    {QueueName: "main", Attributes: QueueAttributesConf{DeadLetterQueue: "z-dlq", MaxReceiveCount: 5}},
+		"z-dlq":     {QueueName: "dlq"},
+		"unchanged": {QueueName: "unchanged", Attributes: QueueAttributesConf{VisibilityTimeout: 30}},
+		"drifted":   {QueueName: "drifted", Attributes: QueueAttributesConf{VisibilityTimeout: 30}},
+	})
+	plan, err := p.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []QueueChange{
+		{Queue: "z-dlq", QueueName: "dlq", Create: true},
+		{Queue: "a-main", QueueName: "main", Create: true, Attributes: []AttributeChange{
+			{Name: sqs.QueueAttributeNameRedrivePolicy, Desired: `{"deadLetterTargetArn":"(arn of dlq)","maxReceiveCount":"5"}`},
+		}},
+		{Queue: "drifted", QueueName: "drifted", Attributes: []AttributeChange{
+			{Name: sqs.QueueAttributeNameRedrivePolicy,
+				Current: `{"deadLetterTargetArn":"` + fake.arn("old") + `","maxReceiveCount":3}`},
+			{Name: sqs.QueueAttributeNameVisibilityTimeout, Current: "45", Desired: "30"},
+		}},
+	}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Errorf("Plan() = %+v, want %+v", plan.Changes, want)
+	}
+	for _, action := range fake.actions {
+		if !strings.HasPrefix(action, "Get") {
+			t.Errorf("Plan() made change %s", action)
+		}
+	}
+}
+
+func TestProvisionApply(t *testing.T) {
+	fake := newFakeSQS()
+	defer fake.Close()
+	fake.addQueue("drifted", map[string]string{sqs.QueueAttributeNameVisibilityTimeout: "45"})
+
+	p := newTestProvisioner(t, fake, map[string]QueueConf{
+		"a-main":  {QueueName: "main", Attributes: QueueAttributesConf{DeadLetterQueue: "z-dlq", MaxReceiveCount: 5}},
+		"z-dlq":   {QueueName: "dlq"},
+		"drifted": {QueueName: "drifted", Attributes: QueueAttributesConf{VisibilityTimeout: 30}},
+	})
+	if _, err := p.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	for _, action := range fake.actions {
+		if !strings.HasPrefix(action, "Get") {
+			changes = append(changes, action[:strings.IndexByte(action, ' ')])
+		}
+	}
+	if want := []string{"CreateQueue", "CreateQueue", "SetQueueAttributes"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	if got, want := fake.queues["main"][sqs.QueueAttributeNameRedrivePolicy],
+		`{"deadLetterTargetArn":"`+fake.arn("dlq")+`","maxReceiveCount":"5"}`; got != want {
+		t.Errorf("redrive policy of main = %s, want %s", got, want)
+	}
+	if got := fake.queues["drifted"][sqs.QueueAttributeNameVisibilityTimeout]; got != "30" {
+		t.Errorf("visibility timeout of drifted = %s, want 30", got)
+	}
+
+	plan, err := p.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("Plan() after Apply() = %s", plan)
+	}
+}
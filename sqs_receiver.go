@@ -2,6 +2,8 @@ package myrpc
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
@@ -9,6 +11,12 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Limits of SQS ReceiveMessage
+const (
+	sqsMaxMsgsPerReceive  = 10
+	sqsMaxWaitTimeSeconds = 20
+)
+
 type sqsReceiver struct {
 	ctx      context.Context
 	sqs      *sqs.SQS
@@ -36,6 +44,11 @@ func (sr *sqsReceiver) ReceiveMsg() ([]*RPCMessage, error) {
 		MaxNumberOfMessages: aws.Int64(sr.conf.NumMsgsPerReceive),
 		VisibilityTimeout:   aws.Int64(sr.conf.VisibilityTimeout), // sec
 		WaitTimeSeconds:     aws.Int64(sr.conf.WaitTimeSeconds),   // sec
+		AttributeNames: aws.StringSlice([]string{
+			sqs.MessageSystemAttributeNameMessageGroupId,
+			sqs.MessageSystemAttributeNameApproximateReceiveCount,
+			sqs.MessageSystemAttributeNameSentTimestamp,
+		}),
 	}
 
 	resp, err := sr.sqs.ReceiveMessageWithContext(sr.ctx, param)
@@ -46,13 +59,37 @@ func (sr *sqsReceiver) ReceiveMsg() ([]*RPCMessage, error) {
 	ret := make([]*RPCMessage, len(resp.Messages))
 
 	for k, m := range resp.Messages {
-		rpcMsg, err := JSONToRPCMsg(*m.Body)
+		rpcMsg, err := JSONToRPCMsg(unwrapSNSNotification(*m.Body))
 		if err != nil {
-			return nil, errors.Wrapf(err, "cannot convert to rpc msg: %+v", m)
+			return nil, errors.Wrapf(err, "cannot convert to rpc msg: %s", aws.StringValue(m.MessageId))
 		}
 		rpcMsg.msgReceiptHandle = *m.ReceiptHandle
+		if count, ok := m.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]; ok {
+			rpcMsg.attempt, _ = strconv.Atoi(*count)
+		}
+		if sentTimestamp, ok := m.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]; ok {
+			if ms, err := strconv.ParseInt(*sentTimestamp, 10, 64); err == nil {
+				rpcMsg.sentAt = time.Unix(0, ms*int64(time.Millisecond))
+			}
+		}
+		if groupID, ok := m.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]; ok && rpcMsg.GroupID == "" {
+			rpcMsg.GroupID = *groupID
+		}
 		ret[k] = rpcMsg
 	}
 
 	return ret, nil
 }
+
+// CheckHealth checks that the queue is reachable
+func (sr *sqsReceiver) CheckHealth() error {
+	param := &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(sr.queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+	}
+	if _, err := sr.sqs.GetQueueAttributesWithContext(sr.ctx, param); err != nil {
+		return errors.Wrapf(err, "cannot get attributes of queue %s", sr.conf.Queue.QueueName)
+	}
+
+	return nil
+}
@@ -2,12 +2,16 @@ package myrpc
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/pkg/errors"
 )
 
+// sqsMaxDelay is the maximum delay of a message that SQS supports
+const sqsMaxDelay = 15 * time.Minute
+
 type sqsSender struct {
 	ctx      context.Context
 	sqs      *sqs.SQS
@@ -31,6 +35,30 @@ func NewSQSSender(ctx context.Context, conf SenderConf) (MessageSender, error) {
 
 // SendAsyncMsg sends message to SQS asynchronously
 func (ss *sqsSender) SendAsyncMsg(msg *RPCMessage) error {
+	return ss.sendMsg(ss.ctx, msg, 0)
+}
+
+// SendAsyncMsgContext sends message to SQS asynchronously within given ctx
+func (ss *sqsSender) SendAsyncMsgContext(ctx context.Context, msg *RPCMessage) error {
+	return ss.sendMsg(ctx, msg, 0)
+}
+
+// SendDelayedMsg sends message to SQS, that is delivered after given delay.
+// Delay is rounded up to seconds, so message is never delivered too early.
+func (ss *sqsSender) SendDelayedMsg(msg *RPCMessage, delay time.Duration) error {
+	if delay > sqsMaxDelay {
+		return errors.Errorf("delay %s exceeds maximum delay %s", delay, sqsMaxDelay)
+	}
+
+	return ss.sendMsg(ss.ctx, msg, delay)
+}
+
+// MaxDelay returns maximum delay that SQS supports
+func (ss *sqsSender) MaxDelay() time.Duration {
+	return sqsMaxDelay
+}
+
+func (ss *sqsSender) sendMsg(ctx context.Context, msg *RPCMessage, delay time.Duration) error {
 	if msg == nil {
 		return errors.New("nil msg is given to SendAsyncMsg")
 	}
@@ -44,15 +72,70 @@ func (ss *sqsSender) SendAsyncMsg(msg *RPCMessage) error {
 		MessageBody: aws.String(msgJSON),
 		QueueUrl:    aws.String(ss.queueURL),
 	}
-	if _, err := ss.sqs.SendMessageWithContext(ss.ctx, sqsMsg); err != nil {
-		return errors.Wrapf(err, "cannot send message to queue: %+v", sqsMsg)
+	if delay > 0 {
+		if ss.isFIFO() {
+			// FIFO queue supports delay per queue only
+			return errors.Errorf("per message delay is not supported on fifo queue %s", ss.conf.Queue.QueueName)
+		}
+		sqsMsg.DelaySeconds = aws.Int64(int64((delay + time.Second - 1) / time.Second))
+	}
+	if ss.isFIFO() {
+		if msg.GroupID == "" {
+			return errors.Errorf("message group id is required on fifo queue %s", ss.conf.Queue.QueueName)
+		}
+		sqsMsg.MessageGroupId = aws.String(msg.GroupID)
+		if msg.DedupID != "" {
+			sqsMsg.MessageDeduplicationId = aws.String(msg.DedupID)
+		}
+	}
+	if _, err := ss.sqs.SendMessageWithContext(ctx, sqsMsg); err != nil {
+		return errors.Wrapf(err, "cannot send message to queue %s. msg: %+v", ss.conf.Queue.QueueName, msg)
 	}
 
 	return nil
 }
 
-// SendSyncMsg sends message to SQS, and wait to response.
+// isFIFO reports whether the queue is a FIFO queue, based on its name
+func (ss *sqsSender) isFIFO() bool {
+	return ss.conf.Queue.isFIFO()
+}
+
+// SendSyncMsg is not supported by SQS itself.
+// Client receives replies from its reply queue instead, see RPCClient.UseReplyQueue.
 func (ss *sqsSender) SendSyncMsg(in *RPCMessage, out interface{}) error {
-	// TODO: implement waiting response with result payload from SQS
-	return errors.New("SQS not support request/reply pattern")
+	return errors.New("SQS not support request/reply pattern, use reply queue of client")
+}
+
+type sqsReplySender struct {
+	ctx context.Context
+	sqs *sqs.SQS
+}
+
+// NewSQSReplySender returns sender of replies to SQS queues by their url,
+// with region and credentials of given queue config
+func NewSQSReplySender(ctx context.Context, conf QueueConf) (ReplySender, error) {
+	sess, err := initSQSSession(conf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot init sqs session for sqsReplySender with conf: %+v", conf)
+	}
+
+	return &sqsReplySender{ctx: ctx, sqs: newSQSService(sess, conf)}, nil
+}
+
+// SendReply sends reply to SQS queue of given url
+func (rs *sqsReplySender) SendReply(replyTo string, msg *RPCMessage) error {
+	msgJSON, err := msg.ToJSON()
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert reply to json: %+v", msg)
+	}
+
+	_, err = rs.sqs.SendMessageWithContext(rs.ctx, &sqs.SendMessageInput{
+		MessageBody: aws.String(msgJSON),
+		QueueUrl:    aws.String(replyTo),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot send reply to queue %s. msg: %+v", replyTo, msg)
+	}
+
+	return nil
 }
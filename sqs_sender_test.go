@@ -0,0 +1,138 @@
+package myrpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSQSQueue(fake *fakeSQS, name string) QueueConf {
+	fake.addQueue(name, nil)
+	return QueueConf{QueueName: name, QueueRegion: "us-east-1", QueueBaseURL: fake.URL,
+		AWSAccessKeyID: "key", AWSSecretAccessKey: "secret"}
+}
+
+func TestSQSSenderFIFO(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   string
+		msg     RPCMessage
+		delay   time.Duration
+		want    *fakeSQSMsg
+		wantErr bool
+	}{
+		{name: "fifo with group", queue: "orders.fifo", msg: RPCMessage{GroupID: "g1"}, want: &fakeSQSMsg{groupID: "g1"}},
+		{name: "fifo with dedup id", queue: "orders.fifo", msg: RPCMessage{GroupID: "g1", DedupID: "d1"},
+			want: &fakeSQSMsg{groupID: "g1", dedupID: "d1"}},
+		{name: "fifo without group", queue: "orders.fifo", wantErr: true},
+		{name: "fifo with delay", queue: "orders.fifo", msg: RPCMessage{GroupID: "g1"}, delay: time.Second, wantErr: true},
+		{name: "standard without group", queue: "orders", want: &fakeSQSMsg{}},
+		{name: "standard with delay rounded up", queue: "orders", delay: 1200 * time.Millisecond, want: &fakeSQSMsg{delay: "2"}},
+		{name: "standard with delay over maximum", queue: "orders", delay: sqsMaxDelay + time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSQS()
+			defer fake.Close()
+			sender, err := NewSQSSender(context.Background(), SenderConf{Queue: newTestSQSQueue(fake, tt.queue)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := tt.msg
+			msg.ID, msg.SvrName, msg.MthName = newID(), "svc", "mth"
+			if tt.delay > 0 {
+				err = sender.(DelayedMessageSender).SendDelayedMsg(&msg, tt.delay)
+			} else {
+				err = sender.SendAsyncMsg(&msg)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			sent := fake.messages[tt.queue]
+			if tt.wantErr {
+				if len(sent) != 0 {
+					t.Errorf("rejected message is sent: %+v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(sent))
+			}
+			got := sent[0]
+			got.body = ""
+			if !reflect.DeepEqual(got, *tt.want) {
+				t.Errorf("sent %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestSQSFIFOGroupOrder(t *testing.T) {
+	fake := newFakeSQS()
+	defer fake.Close()
+	queue := newTestSQSQueue(fake, "orders.fifo")
+	sender, err := NewSQSSender(context.Background(), SenderConf{Queue: queue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewSQSReceiver(context.Background(), ReceiverConf{Queue: queue, NumMsgsPerReceive: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []struct{ group, payload string }{
+		{"a", "a1"}, {"b", "b1"}, {"a", "a2"}, {"c", "c1"}, {"b", "b2"}, {"a", "a3"},
+	} {
+		msg := &RPCMessage{ID: newID(), SvrName: "svc", MthName: "mth", GroupID: m.group, Payload: []byte(m.payload)}
+		if err := sender.SendAsyncMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, err := receiver.ReceiveMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, group := range groupMsgs(msgs) {
+		got = append(got, group[0].GroupID+":"+payloadsOf(group))
+	}
+	// groups are handled concurrently, and messages in each group one at a time in order
+	if want := []string{"a:a1,a2,a3", "b:b1,b2", "c:c1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestGroupMsgs(t *testing.T) {
+	msg := func(id, group string) *RPCMessage {
+		return &RPCMessage{ID: id, GroupID: group}
+	}
+	tests := []struct {
+		name string
+		msgs []*RPCMessage
+		want [][]string
+	}{
+		{"no message", nil, [][]string{}},
+		{"without groups", []*RPCMessage{msg("1", ""), msg("2", "")}, [][]string{{"1"}, {"2"}}},
+		{"by group in order", []*RPCMessage{msg("1", "a"), msg("2", "b"), msg("3", "a"), msg("4", ""), msg("5", "b")},
+			[][]string{{"1", "3"}, {"2", "5"}, {"4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := [][]string{}
+			for _, group := range groupMsgs(tt.msgs) {
+				ids := make([]string, len(group))
+				for i, m := range group {
+					ids[i] = m.ID
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupMsgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package myrpc
+
+import (
+	"context"
+	"time"
+)
+
+// Names of traced steps of handling a message
+const (
+	StepReceive = "receive"
+	StepDecode  = "decode"
+	StepHandle  = "handle"
+	StepDelete  = "delete"
+)
+
+// Tracer is the interface to propagate traces across the queue
+type Tracer interface {
+	// StartProducer starts span of sending a message to given method
+	StartProducer(ctx context.Context, svr ServiceName, mth MethodName) (context.Context, Span)
+	// Inject puts span context of ctx into metadata of message
+	Inject(ctx context.Context, msg *RPCMessage)
+	// StartConsumer extracts span context from metadata of message,
+	// and starts span of handling the message as its child
+	StartConsumer(ctx context.Context, msg *RPCMessage) (context.Context, Span)
+	// StartStep starts span of a step of handling message, which began at given time
+	StartStep(ctx context.Context, step string, start time.Time) (context.Context, Span)
+}
+
+// Span is a traced operation
+type Span interface {
+	// End finishes the span, err is nil on success
+	End(err error)
+}
+
+type nopTracer struct{}
+
+// NopTracer returns a tracer that traces nothing. It is the default tracer.
+func NopTracer() Tracer {
+	return nopTracer{}
+}
+
+func (nopTracer) StartProducer(ctx context.Context, _ ServiceName, _ MethodName) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopTracer) Inject(context.Context, *RPCMessage) {}
+
+func (nopTracer) StartConsumer(ctx context.Context, _ *RPCMessage) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopTracer) StartStep(ctx context.Context, _ string, _ time.Time) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}